@@ -0,0 +1,398 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// LoxBigInt is an integer of unbounded size.
+type LoxBigInt struct {
+	value *big.Int
+}
+
+// LoxDecimal is the exact decimal unscaled × 10^-scale. The scale is kept,
+// so Decimal("1.50") prints as 1.50.
+type LoxDecimal struct {
+	unscaled *big.Int
+	scale    int
+}
+
+// Quotients of decimals get at least this many fractional digits.
+const decimalDivisionScale = 16
+
+// Bounds on the sizes scripts can ask for directly. Beyond them a single
+// shift, exponent or rounding could exhaust memory or time before the
+// allocation limit is checked. Products of decimals are rounded to
+// maxDecimalPlaces fractional digits.
+const (
+	maxShiftCount    = 1 << 20
+	maxDecimalPlaces = 1000
+)
+
+var bigTen = big.NewInt(10)
+
+func newLoxBigInt(value *big.Int) *LoxBigInt {
+	return &LoxBigInt{value: value}
+}
+
+func newLoxDecimal(unscaled *big.Int, scale int) *LoxDecimal {
+	return &LoxDecimal{unscaled: unscaled, scale: scale}
+}
+
+func (b *LoxBigInt) String() string {
+	return b.value.String()
+}
+
+func (d *LoxDecimal) String() string {
+	var digits = new(big.Int).Abs(d.unscaled).String()
+	var sign = ""
+	if d.unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		return sign + digits + strings.Repeat("0", -d.scale)
+	}
+	if len(digits) <= d.scale {
+		digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+}
+
+func isBigNumber(value any) bool {
+	switch value.(type) {
+	case *LoxBigInt, *LoxDecimal:
+		return true
+	}
+	return false
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// parseDecimal reads strings such as "12", "-0.50" and "1.5e-3".
+func parseDecimal(text string) (*LoxDecimal, bool) {
+	text = strings.TrimSpace(text)
+	var exponent = 0
+	if index := strings.IndexAny(text, "eE"); index >= 0 {
+		var err error
+		exponent, err = strconv.Atoi(text[index+1:])
+		if err != nil || exponent < -maxDecimalPlaces || exponent > maxDecimalPlaces {
+			return nil, false
+		}
+		text = text[:index]
+	}
+	var sign = ""
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		sign, text = text[:1], text[1:]
+	}
+	var whole, fraction, _ = strings.Cut(text, ".")
+	var digits = whole + fraction
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return nil, false
+	}
+	unscaled, ok := new(big.Int).SetString(sign+digits, 10)
+	if !ok {
+		return nil, false
+	}
+	var scale = len(fraction) - exponent
+	if scale < 0 {
+		return newLoxDecimal(unscaled.Mul(unscaled, pow10(-scale)), 0), true
+	}
+	return newLoxDecimal(unscaled, scale), true
+}
+
+// toBigInt converts ints and BigInts, and truncates decimals and floats.
+func toBigInt(value any) (*big.Int, bool) {
+	switch v := value.(type) {
+	case int64:
+		return big.NewInt(v), true
+	case *LoxBigInt:
+		return v.value, true
+	case *LoxDecimal:
+		return new(big.Int).Quo(v.unscaled, pow10(v.scale)), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		integer, _ := big.NewFloat(v).Int(nil)
+		return integer, true
+	case string:
+		text := strings.ReplaceAll(strings.TrimSpace(v), "_", "")
+		return new(big.Int).SetString(text, 10)
+	}
+	return nil, false
+}
+
+// toDecimal converts any number exactly. A float becomes the shortest
+// decimal that reads back as the same float, so Decimal(0.1) is 0.1.
+func toDecimal(value any) (*LoxDecimal, bool) {
+	switch v := value.(type) {
+	case int64:
+		return newLoxDecimal(big.NewInt(v), 0), true
+	case *LoxBigInt:
+		return newLoxDecimal(v.value, 0), true
+	case *LoxDecimal:
+		return v, true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		return parseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	case string:
+		return parseDecimal(v)
+	}
+	return nil, false
+}
+
+// rescale returns the unscaled value of d at a scale no smaller than its own.
+func (d *LoxDecimal) rescale(scale int) *big.Int {
+	if scale == d.scale {
+		return d.unscaled
+	}
+	return new(big.Int).Mul(d.unscaled, pow10(scale-d.scale))
+}
+
+func (d *LoxDecimal) rat() *big.Rat {
+	if d.scale >= 0 {
+		return new(big.Rat).SetFrac(d.unscaled, pow10(d.scale))
+	}
+	return new(big.Rat).SetInt(d.rescale(0))
+}
+
+// bigArithmetic applies an operator when either operand is a BigInt or a
+// Decimal. Ints are promoted to BigInts and BigInts to Decimals; floats are
+// rejected because they would make the result inexact.
+func (i *Interpreter) bigArithmetic(operator Token, left any, right any) any {
+	_, leftFloat := left.(float64)
+	_, rightFloat := right.(float64)
+	if leftFloat || rightFloat {
+		RuntimeError(operator, "Can't mix a float with a BigInt or Decimal; convert it first.")
+	}
+	_, leftDecimal := left.(*LoxDecimal)
+	_, rightDecimal := right.(*LoxDecimal)
+	if leftDecimal || rightDecimal {
+		var l, _ = toDecimal(left)
+		var r, _ = toDecimal(right)
+		return i.decimalArithmetic(operator, l, r)
+	}
+	var l, _ = toBigInt(left)
+	var r, _ = toBigInt(right)
+	return i.bigIntArithmetic(operator, l, r)
+}
+
+func (i *Interpreter) bigIntArithmetic(operator Token, left *big.Int, right *big.Int) any {
+	var result = new(big.Int)
+	switch operator.tokenType {
+	case GREATER:
+		return left.Cmp(right) > 0
+	case GREATER_EQUAL:
+		return left.Cmp(right) >= 0
+	case LESS:
+		return left.Cmp(right) < 0
+	case LESS_EQUAL:
+		return left.Cmp(right) <= 0
+	case PLUS:
+		result.Add(left, right)
+	case MINUS:
+		result.Sub(left, right)
+	case STAR:
+		// Charged first, so that a product over the limit is never built.
+		i.allocate((len(left.Bits()) + len(right.Bits())) * 8)
+		result.Mul(left, right)
+	case SLASH:
+		// "/" divides exactly, so the quotient is a Decimal.
+		return i.decimalArithmetic(operator, newLoxDecimal(left, 0), newLoxDecimal(right, 0))
+	case PERCENT:
+		if right.Sign() == 0 {
+			RuntimeError(operator, "Division by zero.")
+		}
+		result.Rem(left, right)
+	case AMPERSAND:
+		result.And(left, right)
+	case PIPE:
+		result.Or(left, right)
+	case CARET:
+		result.Xor(left, right)
+	case LESS_LESS, GREATER_GREATER:
+		if right.Sign() < 0 {
+			RuntimeError(operator, "Shift count can't be negative.")
+		}
+		if right.Cmp(big.NewInt(maxShiftCount)) > 0 {
+			RuntimeError(operator, "Shift count can't be more than "+strconv.Itoa(maxShiftCount)+".")
+		}
+		var count = uint(right.Uint64())
+		if operator.tokenType == LESS_LESS {
+			i.allocate(len(left.Bits())*8 + int(count/8) + 8)
+			result.Lsh(left, count)
+		} else {
+			result.Rsh(left, count)
+		}
+	default:
+		return nil
+	}
+	if operator.tokenType != STAR && operator.tokenType != LESS_LESS {
+		i.allocate(len(result.Bits()) * 8)
+	}
+	return newLoxBigInt(result)
+}
+
+func (i *Interpreter) decimalArithmetic(operator Token, left *LoxDecimal, right *LoxDecimal) any {
+	var scale = max(left.scale, right.scale)
+	var l, r = left.rescale(scale), right.rescale(scale)
+	var result *LoxDecimal
+	switch operator.tokenType {
+	case GREATER:
+		return l.Cmp(r) > 0
+	case GREATER_EQUAL:
+		return l.Cmp(r) >= 0
+	case LESS:
+		return l.Cmp(r) < 0
+	case LESS_EQUAL:
+		return l.Cmp(r) <= 0
+	case PLUS:
+		result = newLoxDecimal(new(big.Int).Add(l, r), scale)
+	case MINUS:
+		result = newLoxDecimal(new(big.Int).Sub(l, r), scale)
+	case STAR:
+		i.allocate((len(left.unscaled.Bits()) + len(right.unscaled.Bits())) * 8)
+		result = newLoxDecimal(new(big.Int).Mul(left.unscaled, right.unscaled), left.scale+right.scale)
+		if result.scale > maxDecimalPlaces {
+			result = result.round(maxDecimalPlaces, HALF_EVEN)
+		}
+	case SLASH:
+		if r.Sign() == 0 {
+			RuntimeError(operator, "Division by zero.")
+		}
+		result = divideDecimal(left, right, max(scale, decimalDivisionScale)).stripZeros(scale)
+	case PERCENT:
+		if r.Sign() == 0 {
+			RuntimeError(operator, "Division by zero.")
+		}
+		result = newLoxDecimal(new(big.Int).Rem(l, r), scale)
+	case AMPERSAND, PIPE, CARET, LESS_LESS, GREATER_GREATER:
+		RuntimeError(operator, "Operands of '"+operator.lexeme+"' must be integers.")
+	default:
+		return nil
+	}
+	if operator.tokenType != STAR {
+		i.allocate(len(result.unscaled.Bits()) * 8)
+	}
+	return result
+}
+
+// divideDecimal computes left / right at the given scale, rounding half to
+// even.
+func divideDecimal(left *LoxDecimal, right *LoxDecimal, scale int) *LoxDecimal {
+	var numerator = new(big.Int).Mul(left.unscaled, pow10(scale-left.scale+right.scale))
+	quotient, remainder := new(big.Int).QuoRem(numerator, right.unscaled, new(big.Int))
+	return newLoxDecimal(roundQuotient(quotient, remainder, right.unscaled, HALF_EVEN), scale)
+}
+
+// stripZeros drops trailing fractional zeros, keeping at least minScale
+// digits after the point.
+func (d *LoxDecimal) stripZeros(minScale int) *LoxDecimal {
+	var unscaled, scale = new(big.Int).Set(d.unscaled), d.scale
+	var remainder = new(big.Int)
+	for scale > minScale {
+		var quotient, _ = new(big.Int).QuoRem(unscaled, bigTen, remainder)
+		if remainder.Sign() != 0 {
+			break
+		}
+		unscaled, scale = quotient, scale-1
+	}
+	return newLoxDecimal(unscaled, scale)
+}
+
+// bigEqual compares numbers of any kind by their exact values.
+func bigEqual(a any, b any) bool {
+	var ra, oka = toRat(a)
+	var rb, okb = toRat(b)
+	return oka && okb && ra.Cmp(rb) == 0
+}
+
+func toRat(value any) (*big.Rat, bool) {
+	switch v := value.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(v), true
+	case *LoxBigInt:
+		return new(big.Rat).SetInt(v.value), true
+	case *LoxDecimal:
+		return v.rat(), true
+	}
+	return nil, false
+}
+
+type roundingMode int
+
+const (
+	HALF_EVEN roundingMode = iota
+	HALF_UP
+	HALF_DOWN
+	UP
+	DOWN
+	CEILING
+	FLOOR
+)
+
+var roundingModes = map[string]roundingMode{
+	"half_even": HALF_EVEN,
+	"half_up":   HALF_UP,
+	"half_down": HALF_DOWN,
+	"up":        UP,
+	"down":      DOWN,
+	"ceiling":   CEILING,
+	"floor":     FLOOR,
+}
+
+// roundQuotient rounds the truncated quotient of a division given its
+// remainder and divisor.
+func roundQuotient(quotient *big.Int, remainder *big.Int, divisor *big.Int, mode roundingMode) *big.Int {
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+	var negative = (remainder.Sign() < 0) != (divisor.Sign() < 0)
+	var twice = new(big.Int).Lsh(new(big.Int).Abs(remainder), 1)
+	// Below, at or above the halfway point between two results.
+	var half = twice.Cmp(new(big.Int).Abs(divisor))
+	var away = false
+	switch mode {
+	case UP:
+		away = true
+	case DOWN:
+		away = false
+	case CEILING:
+		away = !negative
+	case FLOOR:
+		away = negative
+	case HALF_UP:
+		away = half >= 0
+	case HALF_DOWN:
+		away = half > 0
+	case HALF_EVEN:
+		away = half > 0 || (half == 0 && quotient.Bit(0) == 1)
+	}
+	if !away {
+		return quotient
+	}
+	if negative {
+		return new(big.Int).Sub(quotient, big.NewInt(1))
+	}
+	return new(big.Int).Add(quotient, big.NewInt(1))
+}
+
+// round returns d with exactly places fractional digits.
+func (d *LoxDecimal) round(places int, mode roundingMode) *LoxDecimal {
+	if d.scale <= places {
+		return newLoxDecimal(d.rescale(places), places)
+	}
+	quotient, remainder := new(big.Int).QuoRem(d.unscaled, pow10(d.scale-places), new(big.Int))
+	return newLoxDecimal(roundQuotient(quotient, remainder, pow10(d.scale-places), mode), places)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+)
+
+// CancelledError is returned when the context governing a run is done
+// before the script finishes. It unwraps to the context's error.
+type CancelledError struct {
+	cause error
+}
+
+func (ce *CancelledError) Error() string {
+	return "Execution cancelled: " + ce.cause.Error() + "."
+}
+
+func (ce *CancelledError) Unwrap() error {
+	return ce.cause
+}
+
+// InterpretContext runs statements until they finish or ctx is done.
+// Cancellation is checked on every loop iteration and function call. The
+// interpreter can be reused after a cancelled run.
+func (i *Interpreter) InterpretContext(ctx context.Context, statements []Stmt) error {
+	if err := ctx.Err(); err != nil {
+		return &CancelledError{err}
+	}
+	var previousCtx, previousDone = i.ctx, i.done
+	i.ctx, i.done = ctx, ctx.Done()
+	defer func() {
+		i.ctx, i.done = previousCtx, previousDone
+	}()
+	return i.interpret(statements)
+}
+
+// Cancellation can't be caught by a catch clause, and though finally still
+// runs, a return from it doesn't stop the cancellation.
+func (t *loxThrow) catchable() bool {
+	var _, cancelled = t.value.(*CancelledError)
+	return !cancelled
+}
+
+func (i *Interpreter) checkCancelled() {
+	select {
+	case <-i.done:
+		i.cancel(i.ctx.Err())
+	case <-i.deadline:
+		i.exceeded("Deadline exceeded.", i.limits.ctx.Err())
+	default:
+	}
+}
+
+func (i *Interpreter) cancel(cause error) {
+	var line = 0
+	if len(i.frames) > 0 {
+		line = i.frames[len(i.frames)-1].line
+	}
+	panic(&loxThrow{value: &CancelledError{cause}, token: Token{line: line}})
+}
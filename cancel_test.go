@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// interpretCancelled runs a script that never ends until ctx is done and
+// returns its output and error.
+func interpretCancelled(t *testing.T, interpreter *Interpreter, stdout *strings.Builder, ctx context.Context, source string) (string, error) {
+	t.Helper()
+	stdout.Reset()
+	var err = interpreter.InterpretContext(ctx, compile(t, interpreter, source))
+	return stdout.String(), err
+}
+
+func TestInterpretContext(t *testing.T) {
+	var stdout strings.Builder
+	var interpreter = newInterpreter(withStdout(&stdout))
+
+	var cancelled, cancel = context.WithCancel(context.Background())
+	cancel()
+	var output, err = interpretCancelled(t, interpreter, &stdout, cancelled, `print "never";`)
+	var cancelledErr *CancelledError
+	if output != "" || !errors.As(err, &cancelledErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("already cancelled: got stdout %q and %v", output, err)
+	}
+
+	var ctx, stop = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, stop)
+	output, err = interpretCancelled(t, interpreter, &stdout, ctx, `
+print "start";
+fun spin() { while (true) {} }
+try { spin(); } catch (e) { print "caught"; }
+print "after";
+`)
+	if output != "start\n" || !errors.As(err, &cancelledErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled while running: got stdout %q and %v", output, err)
+	}
+	if err != nil && err.Error() != "Execution cancelled: context canceled." {
+		t.Errorf("got message %q", err.Error())
+	}
+
+	var timeout, release = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer release()
+	output, err = interpretCancelled(t, interpreter, &stdout, timeout, `
+fun f() {
+  try { while (true) {} } finally { print "finally"; return "swallowed"; }
+}
+print f();
+print "after";
+`)
+	if output != "finally\n" || !errors.As(err, &cancelledErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("return from finally: got stdout %q and %v", output, err)
+	}
+
+	// The interpreter is left in a usable state, with the globals defined
+	// before the cancellation.
+	output, err = interpretCancelled(t, interpreter, &stdout, context.Background(), `
+print f;
+fun g(n) { if (n == 0) return "done"; return g(n - 1); }
+print g(10);
+`)
+	if output != "<fn f>\ndone\n" || err != nil {
+		t.Errorf("reused: got stdout %q and %v", output, err)
+	}
+	if len(interpreter.frames) != 0 || interpreter.environment != interpreter.globals {
+		t.Errorf("left %d frames and environment %p", len(interpreter.frames), interpreter.environment)
+	}
+	stdout.Reset()
+	if err := interpreter.interpret(compile(t, interpreter, `print "plain";`)); err != nil || stdout.String() != "plain\n" {
+		t.Errorf("interpret after a cancellation: got stdout %q and %v", stdout.String(), err)
+	}
+}
+
+// TestDeadlineIsCatchable checks that the deadline of withContext, unlike
+// the context of InterpretContext, raises an error scripts can catch.
+func TestDeadlineIsCatchable(t *testing.T) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var stdout, stderr = runCaptured(`try { while (true) {} } catch (e) { print e.message; }`, "", withContext(ctx))
+	if stdout != "Deadline exceeded.\n" || stderr != "" {
+		t.Errorf("got stdout %q and stderr %q", stdout, stderr)
+	}
+}
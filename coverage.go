@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// coverageFile is the code of one loaded file: its statements, the If and
+// Logical nodes that branch, and its function declarations.
+type coverageFile struct {
+	path       string
+	statements []Stmt
+	branches   []any
+	functions  []*Function
+	names      map[*Function]string
+	lines      map[any]int
+}
+
+// Coverage records how many times each statement, branch and function of
+// the loaded files ran.
+type Coverage struct {
+	files      []*coverageFile
+	loadedPath map[string]bool
+	statements map[Stmt]int
+	branches   map[any]*[2]int
+	functions  map[*Function]int
+}
+
+func newCoverage() *Coverage {
+	return &Coverage{
+		loadedPath: map[string]bool{},
+		statements: map[Stmt]int{},
+		branches:   map[any]*[2]int{},
+		functions:  map[*Function]int{},
+	}
+}
+
+// loaded collects the code of a file. Code typed at the prompt has no file
+// and isn't covered.
+func (c *Coverage) loaded(i *Interpreter, path string, statements []Stmt) {
+	if path == "" || c.loadedPath[absolutePath(path)] {
+		return
+	}
+	var file = &coverageFile{path: absolutePath(path), names: map[*Function]string{}, lines: map[any]int{}}
+	c.loadedPath[file.path] = true
+	c.files = append(c.files, file)
+	for _, stmt := range statements {
+		walkTree(stmt, func(node any) {
+			switch node := node.(type) {
+			case *If:
+				file.branches = append(file.branches, node)
+			case *Logical:
+				file.branches = append(file.branches, node)
+				file.lines[node] = node.operator.line
+			case *Function:
+				file.functions = append(file.functions, node)
+			case *Class:
+				for _, method := range node.methods {
+					file.names[method] = node.name.lexeme + "." + method.name.lexeme
+				}
+			case *Trait:
+				for _, method := range node.methods {
+					file.names[method] = node.name.lexeme + "." + method.name.lexeme
+				}
+			}
+			if stmt, ok := node.(Stmt); ok {
+				if line, ok := i.lines[stmt]; ok {
+					file.statements = append(file.statements, stmt)
+					file.lines[stmt] = line
+				}
+			}
+		})
+	}
+}
+
+func (c *Coverage) beforeStatement(i *Interpreter, stmt Stmt) {
+	c.statements[stmt]++
+}
+
+func (c *Coverage) enterFunction(i *Interpreter, function LoxCallable, arguments []any) {
+	if function, ok := function.(*LoxFunction); ok {
+		c.functions[function.declaration]++
+	}
+}
+
+func (c *Coverage) exitFunction(i *Interpreter, function LoxCallable, value any) {}
+
+func (c *Coverage) branchTaken(i *Interpreter, node any, branch int) {
+	counts, ok := c.branches[node]
+	if !ok {
+		counts = &[2]int{}
+		c.branches[node] = counts
+	}
+	counts[branch]++
+}
+
+func (c *Coverage) assigned(i *Interpreter, name Token, value any) {}
+
+// lineCounts gives the hits of every line with a statement. A line counts
+// as often as its most executed statement.
+func (c *Coverage) lineCounts(file *coverageFile) (lines []int, counts map[int]int) {
+	counts = map[int]int{}
+	for _, stmt := range file.statements {
+		var line = file.lines[stmt]
+		count, ok := counts[line]
+		if !ok {
+			lines = append(lines, line)
+		}
+		if !ok || c.statements[stmt] > count {
+			counts[line] = c.statements[stmt]
+		}
+	}
+	sort.Ints(lines)
+	return lines, counts
+}
+
+func (c *Coverage) functionName(file *coverageFile, function *Function) string {
+	if name, ok := file.names[function]; ok {
+		return name
+	}
+	return function.name.lexeme
+}
+
+// writeLcov writes the coverage in the lcov tracefile format.
+func (c *Coverage) writeLcov(out io.Writer) {
+	for _, file := range c.files {
+		fmt.Fprintln(out, "TN:")
+		fmt.Fprintln(out, "SF:"+file.path)
+		var hit = 0
+		for _, function := range file.functions {
+			fmt.Fprintf(out, "FN:%d,%s\n", function.name.line, c.functionName(file, function))
+		}
+		for _, function := range file.functions {
+			fmt.Fprintf(out, "FNDA:%d,%s\n", c.functions[function], c.functionName(file, function))
+			if c.functions[function] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(out, "FNF:%d\nFNH:%d\n", len(file.functions), hit)
+
+		hit = 0
+		for block, node := range file.branches {
+			var line = file.lines[node]
+			counts, ok := c.branches[node]
+			for branch := 0; branch < 2; branch++ {
+				if !ok {
+					fmt.Fprintf(out, "BRDA:%d,%d,%d,-\n", line, block, branch)
+					continue
+				}
+				fmt.Fprintf(out, "BRDA:%d,%d,%d,%d\n", line, block, branch, counts[branch])
+				if counts[branch] > 0 {
+					hit++
+				}
+			}
+		}
+		fmt.Fprintf(out, "BRF:%d\nBRH:%d\n", 2*len(file.branches), hit)
+
+		hit = 0
+		var lines, counts = c.lineCounts(file)
+		for _, line := range lines {
+			fmt.Fprintf(out, "DA:%d,%d\n", line, counts[line])
+			if counts[line] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(out, "LF:%d\nLH:%d\n", len(lines), hit)
+		fmt.Fprintln(out, "end_of_record")
+	}
+}
+
+// writeSummary writes the percentage of lines, branches and functions
+// covered in each file.
+func (c *Coverage) writeSummary(out io.Writer) {
+	var percent = func(hit int, total int) string {
+		if total == 0 {
+			return "     -"
+		}
+		return fmt.Sprintf("%5.1f%%", 100*float64(hit)/float64(total))
+	}
+	fmt.Fprintf(out, "%-40s %-16s %-16s %-16s\n", "File", "Lines", "Branches", "Functions")
+	for _, file := range c.files {
+		var lines, counts = c.lineCounts(file)
+		var linesHit = 0
+		for _, line := range lines {
+			if counts[line] > 0 {
+				linesHit++
+			}
+		}
+		var branchesHit = 0
+		for _, node := range file.branches {
+			if counts, ok := c.branches[node]; ok {
+				for _, count := range counts {
+					if count > 0 {
+						branchesHit++
+					}
+				}
+			}
+		}
+		var functionsHit = 0
+		for _, function := range file.functions {
+			if c.functions[function] > 0 {
+				functionsHit++
+			}
+		}
+		fmt.Fprintf(out, "%-40s %s %4d/%-4d %s %4d/%-4d %s %4d/%-4d\n", displayPath(file.path),
+			percent(linesHit, len(lines)), linesHit, len(lines),
+			percent(branchesHit, 2*len(file.branches)), branchesHit, 2*len(file.branches),
+			percent(functionsHit, len(file.functions)), functionsHit, len(file.functions))
+	}
+}
+
+// walkTree calls visit with node and every statement and expression nested
+// in it, parents before their children.
+func walkTree(node any, visit func(node any)) {
+	if node == nil {
+		return
+	}
+	visit(node)
+	var walk = func(children ...any) {
+		for _, child := range children {
+			walkTree(child, visit)
+		}
+	}
+	switch node := node.(type) {
+	case *Block:
+		walkStatements(node.statements, visit)
+	case *Class:
+		if node.superclass != nil {
+			walk(node.superclass)
+		}
+		for _, trait := range node.traits {
+			walk(trait)
+		}
+		for _, method := range node.methods {
+			walk(method)
+		}
+	case *Trait:
+		for _, method := range node.methods {
+			walk(method)
+		}
+	case *Function:
+		walkStatements(node.body, visit)
+	case *Expression:
+		walk(node.expression)
+	case *Print:
+		walk(node.expression)
+	case *Return:
+		walk(node.value)
+	case *Throw:
+		walk(node.value)
+	case *Va:
+		walk(node.initializer)
+	case *If:
+		walk(node.condition, node.thenBranch, node.elseBranch)
+	case *While:
+		walk(node.condition, node.body)
+	case *Try:
+		walkStatements(node.body, visit)
+		walkStatements(node.catchBody, visit)
+		walkStatements(node.finallyBody, visit)
+	case *Assign:
+		walk(node.value)
+	case *Binary:
+		walk(node.left, node.right)
+	case *Logical:
+		walk(node.left, node.right)
+	case *Call:
+		walk(node.callee)
+		walk(node.arguments...)
+	case *Get:
+		walk(node.object)
+	case *Set:
+		walk(node.object, node.value)
+	case *Grouping:
+		walk(node.expression)
+	case *Index:
+		walk(node.object, node.index)
+	case *Interpolation:
+		for _, part := range node.parts {
+			walk(part)
+		}
+	case *Unary:
+		walk(node.right)
+	}
+}
+
+func walkStatements(statements []Stmt, visit func(node any)) {
+	for _, stmt := range statements {
+		walkTree(stmt, visit)
+	}
+}
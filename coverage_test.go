@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const coverageProgram = `fun check(x) {
+  if (x > 1 and x < 5) {
+    return "in";
+  }
+  return "out";
+}
+fun unused() {
+  return nil;
+}
+print check(2);
+print check(0);
+print check(7);
+`
+
+// The if on line 2 is block 0, taken once and skipped twice. The and is
+// block 1: its right operand runs for 2 and 7, not for 0.
+const coverageLcov = `TN:
+SF:PATH
+FN:1,check
+FN:7,unused
+FNDA:3,check
+FNDA:0,unused
+FNF:2
+FNH:1
+BRDA:2,0,0,1
+BRDA:2,0,1,2
+BRDA:2,1,0,2
+BRDA:2,1,1,1
+BRF:4
+BRH:4
+DA:1,1
+DA:2,3
+DA:3,1
+DA:5,2
+DA:7,1
+DA:8,0
+DA:10,1
+DA:11,1
+DA:12,1
+LF:9
+LH:8
+end_of_record
+`
+
+func TestCoverageLcov(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "main.lox")
+	if err := os.WriteFile(path, []byte(coverageProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var coverage = newCoverage()
+	var stdout, stderr = runCapturedAt(coverageProgram, path, "", withHook(coverage))
+	if stdout != "in\nout\nout\n" || stderr != "" {
+		t.Fatalf("got stdout %q and stderr %q", stdout, stderr)
+	}
+	var lcov strings.Builder
+	coverage.writeLcov(&lcov)
+	if want := strings.Replace(coverageLcov, "PATH", absolutePath(path), 1); lcov.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", lcov.String(), want)
+	}
+	var summary strings.Builder
+	coverage.writeSummary(&summary)
+	if !strings.Contains(summary.String(), " 88.9%    8/9    100.0%    4/4     50.0%    1/2") {
+		t.Errorf("got summary\n%s", summary.String())
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dapServer speaks the Debug Adapter Protocol over a pair of streams, so
+// that editors such as VS Code can debug Lox scripts. lox dap serves it on
+// stdin and stdout. Requests are read on the goroutine that calls serve and
+// the script runs on another one; while the script is paused, requests that
+// inspect it are handed to the script's goroutine through commands.
+type dapServer struct {
+	in         *bufio.Reader
+	out        io.Writer
+	writeMu    sync.Mutex
+	seq        int
+	options    []interpreterOption
+	debugger   *Debugger
+	program    string
+	source     string
+	launched   bool
+	configured bool
+	started    bool
+	done       chan struct{}
+
+	mu          sync.Mutex
+	stopOnEntry bool
+	paused      bool
+	terminating bool
+	commands    chan dapCommand
+	// handles are the values behind variablesReference numbers. They are
+	// only valid while the script stays paused.
+	handles []any
+}
+
+type dapCommand struct {
+	run  func(i *Interpreter) bool
+	done chan struct{}
+}
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+func newDapServer(in io.Reader, out io.Writer, options ...interpreterOption) *dapServer {
+	var server = &dapServer{
+		in:       bufio.NewReader(in),
+		out:      out,
+		options:  options,
+		done:     make(chan struct{}),
+		commands: make(chan dapCommand),
+	}
+	server.debugger = newDebugger(server.pause)
+	return server
+}
+
+// serve handles requests until the client disconnects or closes the stream.
+func (s *dapServer) serve() error {
+	for {
+		request, err := s.read()
+		if err != nil {
+			s.stop()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if !s.handle(request) {
+			return nil
+		}
+	}
+}
+
+func (s *dapServer) read() (*dapRequest, error) {
+	var headers, err = textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length header: %w", err)
+	}
+	var body = make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	var request = &dapRequest{}
+	if err := json.Unmarshal(body, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func (s *dapServer) send(message map[string]any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	message["seq"] = s.seq
+	var body, _ = json.Marshal(message)
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *dapServer) respond(request *dapRequest, body any) {
+	s.send(map[string]any{"type": "response", "request_seq": request.Seq, "command": request.Command, "success": true, "body": body})
+}
+
+func (s *dapServer) fail(request *dapRequest, message string) {
+	s.send(map[string]any{"type": "response", "request_seq": request.Seq, "command": request.Command, "success": false, "message": message})
+}
+
+func (s *dapServer) event(name string, body any) {
+	s.send(map[string]any{"type": "event", "event": name, "body": body})
+}
+
+// handle answers one request and reports whether to keep serving.
+func (s *dapServer) handle(request *dapRequest) bool {
+	switch request.Command {
+	case "initialize":
+		s.respond(request, map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+			"supportTerminateDebuggee":         true,
+		})
+		s.event("initialized", map[string]any{})
+	case "launch":
+		var arguments struct {
+			Program     string `json:"program"`
+			StopOnEntry bool   `json:"stopOnEntry"`
+		}
+		json.Unmarshal(request.Arguments, &arguments)
+		source, err := os.ReadFile(arguments.Program)
+		if err != nil {
+			s.fail(request, "Could not read '"+arguments.Program+"'.")
+			return true
+		}
+		s.program, s.source = arguments.Program, string(source)
+		s.mu.Lock()
+		s.stopOnEntry = arguments.StopOnEntry
+		s.mu.Unlock()
+		s.launched = true
+		s.respond(request, nil)
+		s.start()
+	case "setBreakpoints":
+		var arguments struct {
+			Source      dapSource `json:"source"`
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		json.Unmarshal(request.Arguments, &arguments)
+		var lines = []int{}
+		var breakpoints = []map[string]any{}
+		for _, breakpoint := range arguments.Breakpoints {
+			lines = append(lines, breakpoint.Line)
+			breakpoints = append(breakpoints, map[string]any{"verified": true, "line": breakpoint.Line})
+		}
+		s.debugger.replaceBreakpoints(arguments.Source.Path, lines)
+		s.respond(request, map[string]any{"breakpoints": breakpoints})
+	case "setFunctionBreakpoints":
+		var arguments struct {
+			Breakpoints []struct {
+				Name string `json:"name"`
+			} `json:"breakpoints"`
+		}
+		json.Unmarshal(request.Arguments, &arguments)
+		var names = []string{}
+		var breakpoints = []map[string]any{}
+		for _, breakpoint := range arguments.Breakpoints {
+			names = append(names, breakpoint.Name)
+			breakpoints = append(breakpoints, map[string]any{"verified": true})
+		}
+		s.debugger.replaceFunctionBreakpoints(names)
+		s.respond(request, map[string]any{"breakpoints": breakpoints})
+	case "setExceptionBreakpoints":
+		s.respond(request, map[string]any{})
+	case "configurationDone":
+		s.configured = true
+		s.respond(request, nil)
+		s.start()
+	case "threads":
+		s.respond(request, map[string]any{"threads": []map[string]any{{"id": 1, "name": "main"}}})
+	case "stackTrace", "scopes", "variables", "evaluate", "continue", "next", "stepIn", "stepOut":
+		if !s.whilePaused(func(i *Interpreter) bool { return s.inspect(i, request) }) {
+			s.fail(request, "The script is not paused.")
+		}
+	case "pause":
+		s.debugger.requestPause()
+		s.respond(request, nil)
+	case "disconnect", "terminate":
+		s.stop()
+		s.respond(request, nil)
+		return request.Command == "terminate"
+	default:
+		s.fail(request, "Unsupported request '"+request.Command+"'.")
+	}
+	return true
+}
+
+// start runs the program once it is launched and the client has finished
+// setting breakpoints.
+func (s *dapServer) start() {
+	if !s.launched || !s.configured || s.started {
+		return
+	}
+	s.started = true
+	s.mu.Lock()
+	if !s.stopOnEntry {
+		s.debugger.resume(RUN)
+	}
+	s.mu.Unlock()
+	// Copied, so that appending never writes to the caller's slice.
+	var options = append(append([]interpreterOption{}, s.options...),
+		withHook(s.debugger),
+		withStdout(&dapOutput{s, "stdout"}),
+		withStderr(&dapOutput{s, "stderr"}),
+		withStdin(bufio.NewReader(strings.NewReader(""))))
+	go func() {
+		defer close(s.done)
+		var exitCode = 0
+		if !run(s.source, s.program, options...) {
+			exitCode = 1
+		}
+		s.event("exited", map[string]any{"exitCode": exitCode})
+		s.event("terminated", map[string]any{})
+	}()
+}
+
+// stop ends the program, if it is running, and waits for it to finish.
+func (s *dapServer) stop() {
+	if !s.started {
+		return
+	}
+	s.mu.Lock()
+	s.terminating = true
+	s.mu.Unlock()
+	s.debugger.detach()
+	s.debugger.requestPause()
+	s.whilePaused(func(i *Interpreter) bool {
+		return true
+	})
+	<-s.done
+}
+
+// pause is called on the script's goroutine whenever the debugger stops. It
+// runs commands until one of them resumes the script, and stops the script
+// if the client asked to terminate it.
+func (s *dapServer) pause(i *Interpreter, reason string) {
+	defer func() {
+		s.mu.Lock()
+		var terminating = s.terminating
+		s.mu.Unlock()
+		if terminating {
+			i.cancel(errDebuggerQuit)
+		}
+	}()
+	s.mu.Lock()
+	if s.terminating {
+		s.mu.Unlock()
+		return
+	}
+	s.paused = true
+	s.handles = nil
+	if reason == "step" && s.stopOnEntry {
+		reason = "entry"
+	}
+	s.stopOnEntry = false
+	s.mu.Unlock()
+	s.event("stopped", map[string]any{"reason": reason, "threadId": 1, "allThreadsStopped": true})
+	for command := range s.commands {
+		var resume = command.run(i)
+		if resume {
+			s.mu.Lock()
+			s.paused = false
+			s.mu.Unlock()
+		}
+		close(command.done)
+		if resume {
+			return
+		}
+	}
+}
+
+// whilePaused runs code on the script's goroutine and waits for it. It
+// reports false if the script isn't paused.
+func (s *dapServer) whilePaused(code func(i *Interpreter) bool) bool {
+	s.mu.Lock()
+	var paused = s.paused
+	s.mu.Unlock()
+	if !paused {
+		return false
+	}
+	var command = dapCommand{code, make(chan struct{})}
+	s.commands <- command
+	<-command.done
+	return true
+}
+
+// inspect answers a request about the paused script, and reports whether
+// the request resumes it.
+func (s *dapServer) inspect(i *Interpreter, request *dapRequest) bool {
+	var d = s.debugger
+	var arguments struct {
+		FrameID            int    `json:"frameId"`
+		VariablesReference int    `json:"variablesReference"`
+		Expression         string `json:"expression"`
+	}
+	json.Unmarshal(request.Arguments, &arguments)
+	switch request.Command {
+	case "continue":
+		d.resume(RUN)
+		s.respond(request, map[string]any{"allThreadsContinued": true})
+		return true
+	case "next":
+		d.resume(STEP_OVER)
+		s.respond(request, nil)
+		return true
+	case "stepIn":
+		d.resume(STEP_INTO)
+		s.respond(request, nil)
+		return true
+	case "stepOut":
+		d.resume(STEP_OUT)
+		s.respond(request, nil)
+		return true
+	case "stackTrace":
+		var frames = []map[string]any{}
+		for index := len(d.stack) - 1; index >= 0; index-- {
+			var frame = map[string]any{"id": index + 1, "name": d.frameName(i, index), "line": 0, "column": 0}
+			if module := d.stack[index].module; module != nil {
+				var path = absolutePath(module.path)
+				frame["line"], frame["column"] = d.stack[index].line, 1
+				frame["source"] = dapSource{Name: filepath.Base(path), Path: path}
+			} else {
+				frame["presentationHint"] = "subtle"
+			}
+			frames = append(frames, frame)
+		}
+		s.respond(request, map[string]any{"stackFrames": frames, "totalFrames": len(frames)})
+	case "scopes":
+		frame, ok := s.frame(arguments.FrameID)
+		if !ok {
+			s.fail(request, "Unknown frame.")
+			return false
+		}
+		var scopes = []map[string]any{}
+		for environment := frame.environment; environment != nil && environment.values == nil; environment = environment.enclosing {
+			var name = "Enclosing scope"
+			if len(scopes) == 0 {
+				name = "Locals"
+			}
+			scopes = append(scopes, map[string]any{"name": name, "variablesReference": s.newHandle(environment), "expensive": false})
+		}
+		scopes = append(scopes, map[string]any{"name": "Globals", "variablesReference": s.newHandle(frame.module.globals), "expensive": false})
+		s.respond(request, map[string]any{"scopes": scopes})
+	case "variables":
+		var index = arguments.VariablesReference - 1
+		if index < 0 || index >= len(s.handles) {
+			s.fail(request, "Unknown variables reference.")
+			return false
+		}
+		s.respond(request, map[string]any{"variables": s.variables(i, s.handles[index])})
+	case "evaluate":
+		frame, ok := s.frame(arguments.FrameID)
+		if !ok {
+			frame = d.stack[len(d.stack)-1]
+		}
+		s.respond(request, map[string]any{"result": d.evaluate(i, frame, arguments.Expression), "variablesReference": 0})
+	}
+	return false
+}
+
+func (s *dapServer) frame(id int) (debugFrame, bool) {
+	var stack = s.debugger.stack
+	if id < 1 || id > len(stack) || stack[id-1].module == nil {
+		return debugFrame{}, false
+	}
+	return stack[id-1], true
+}
+
+func (s *dapServer) newHandle(value any) int {
+	s.handles = append(s.handles, value)
+	return len(s.handles)
+}
+
+// variables lists the variables of an environment or the fields of an
+// instance. Instances can be expanded in turn.
+func (s *dapServer) variables(i *Interpreter, container any) []map[string]any {
+	var variables = []map[string]any{}
+	var add = func(name string, value any) {
+		var reference = 0
+		if instance, ok := value.(*LoxInstance); ok && len(instance.values) > 0 {
+			reference = s.newHandle(instance)
+		}
+		variables = append(variables, map[string]any{"name": name, "value": s.debugger.show(i, value), "variablesReference": reference})
+	}
+	switch c := container.(type) {
+	case *Environment:
+		if c.values != nil {
+			for _, name := range sortedKeys(c.values) {
+				add(name, c.values[name])
+			}
+			break
+		}
+		for slot, name := range c.names {
+			add(name, c.slots[slot])
+		}
+	case *LoxInstance:
+		var fields = c.fields()
+		for _, name := range sortedKeys(fields) {
+			add(name, fields[name])
+		}
+	}
+	return variables
+}
+
+// dapOutput turns what the script writes into output events.
+type dapOutput struct {
+	server   *dapServer
+	category string
+}
+
+func (o *dapOutput) Write(p []byte) (int, error) {
+	o.server.event("output", map[string]any{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// dapClient sends scripted requests to a DAP server over an in-memory pipe.
+type dapClient struct {
+	t        *testing.T
+	conn     net.Conn
+	seq      int
+	messages chan map[string]any
+	skipped  []map[string]any
+}
+
+func newDapClient(t *testing.T) *dapClient {
+	var clientEnd, serverEnd = net.Pipe()
+	var server = newDapServer(serverEnd, serverEnd)
+	var served = make(chan error, 1)
+	go func() {
+		served <- server.serve()
+		serverEnd.Close()
+	}()
+	var client = &dapClient{t: t, conn: clientEnd, messages: make(chan map[string]any, 100)}
+	go client.receive()
+	t.Cleanup(func() {
+		clientEnd.Close()
+		select {
+		case <-served:
+		case <-time.After(5 * time.Second):
+			t.Error("the server didn't stop")
+		}
+	})
+	return client
+}
+
+func (c *dapClient) receive() {
+	defer close(c.messages)
+	var reader = bufio.NewReader(c.conn)
+	for {
+		var headers, err = textproto.NewReader(reader).ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+		length, _ := strconv.Atoi(headers.Get("Content-Length"))
+		var body = make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+		var message = map[string]any{}
+		json.Unmarshal(body, &message)
+		c.messages <- message
+	}
+}
+
+func (c *dapClient) send(command string, arguments any) int {
+	c.seq++
+	var body, _ = json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return c.seq
+}
+
+// until returns the first message that matches. The messages it skips are
+// kept for later calls, as events may arrive before a response.
+func (c *dapClient) until(description string, match func(message map[string]any) bool) map[string]any {
+	c.t.Helper()
+	for index, message := range c.skipped {
+		if match(message) {
+			c.skipped = append(c.skipped[:index], c.skipped[index+1:]...)
+			return message
+		}
+	}
+	var timeout = time.After(5 * time.Second)
+	for {
+		select {
+		case message, ok := <-c.messages:
+			if !ok {
+				c.t.Fatalf("the server closed the stream waiting for %s", description)
+			}
+			if match(message) {
+				return message
+			}
+			c.skipped = append(c.skipped, message)
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for %s", description)
+		}
+	}
+}
+
+// request sends a request and returns the body of its successful response.
+func (c *dapClient) request(command string, arguments any) map[string]any {
+	c.t.Helper()
+	var seq = c.send(command, arguments)
+	var response = c.until(command+" response", func(message map[string]any) bool {
+		return message["type"] == "response" && message["request_seq"] == float64(seq)
+	})
+	if response["success"] != true {
+		c.t.Fatalf("%s failed: %v", command, response["message"])
+	}
+	body, _ := response["body"].(map[string]any)
+	return body
+}
+
+func (c *dapClient) event(name string) map[string]any {
+	c.t.Helper()
+	var event = c.until(name+" event", func(message map[string]any) bool {
+		return message["type"] == "event" && message["event"] == name
+	})
+	body, _ := event["body"].(map[string]any)
+	return body
+}
+
+// variables returns the names and values of a variables reference.
+func (c *dapClient) variables(reference any) map[string]string {
+	c.t.Helper()
+	var variables = map[string]string{}
+	var body = c.request("variables", map[string]any{"variablesReference": reference})
+	for _, variable := range body["variables"].([]any) {
+		var v = variable.(map[string]any)
+		variables[v["name"].(string)] = v["value"].(string)
+	}
+	return variables
+}
+
+const dapProgram = `class Point {
+  init(x, y) {
+    this.x = x;
+    this.y = y;
+  }
+  sum() {
+    var total = this.x + this.y;
+    return total;
+  }
+}
+var p = Point(1, 2);
+print p.sum();
+`
+
+func writeDapProgram(t *testing.T) string {
+	var path = filepath.Join(t.TempDir(), "main.lox")
+	if err := os.WriteFile(path, []byte(dapProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDapBreakpoint(t *testing.T) {
+	var path = writeDapProgram(t)
+	var client = newDapClient(t)
+	client.request("initialize", map[string]any{"adapterID": "lox"})
+	client.event("initialized")
+	client.request("launch", map[string]any{"program": path})
+	var breakpoints = client.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": path},
+		"breakpoints": []map[string]any{{"line": 8}},
+	})
+	if len(breakpoints["breakpoints"].([]any)) != 1 {
+		t.Errorf("got breakpoints %v", breakpoints)
+	}
+	client.request("configurationDone", nil)
+
+	var stopped = client.event("stopped")
+	if stopped["reason"] != "breakpoint" {
+		t.Errorf("stopped for %v, want breakpoint", stopped["reason"])
+	}
+	var frames = client.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+	var top = frames[0].(map[string]any)
+	if len(frames) != 2 || top["line"] != float64(8) || top["name"] != "<fn sum>" {
+		t.Errorf("got stack frames %v", frames)
+	}
+	var scopes = client.request("scopes", map[string]any{"frameId": top["id"]})["scopes"].([]any)
+	var locals = client.variables(scopes[0].(map[string]any)["variablesReference"])
+	if locals["total"] != "3" || locals["this"] != "Point instance" {
+		t.Errorf("got locals %v", locals)
+	}
+	var globals = client.variables(scopes[len(scopes)-1].(map[string]any)["variablesReference"])
+	if globals["Point"] != "Point" || globals["p"] != "Point instance" {
+		t.Errorf("got globals %v", globals)
+	}
+	var result = client.request("evaluate", map[string]any{"expression": "total * 10", "frameId": top["id"]})
+	if result["result"] != "30" {
+		t.Errorf("evaluated total * 10 to %v", result["result"])
+	}
+
+	client.request("continue", map[string]any{"threadId": 1})
+	var output = client.event("output")
+	if output["category"] != "stdout" || output["output"] != "3\n" {
+		t.Errorf("got output %v", output)
+	}
+	if exited := client.event("exited"); exited["exitCode"] != float64(0) {
+		t.Errorf("exited with %v", exited["exitCode"])
+	}
+	client.event("terminated")
+	client.request("disconnect", nil)
+}
+
+func TestDapStopOnEntryAndStep(t *testing.T) {
+	var path = writeDapProgram(t)
+	var client = newDapClient(t)
+	client.request("initialize", map[string]any{"adapterID": "lox"})
+	client.request("launch", map[string]any{"program": path, "stopOnEntry": true})
+	client.request("configurationDone", nil)
+
+	if stopped := client.event("stopped"); stopped["reason"] != "entry" {
+		t.Errorf("stopped for %v, want entry", stopped["reason"])
+	}
+	var line = func() any {
+		var frames = client.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+		return frames[0].(map[string]any)["line"]
+	}
+	if got := line(); got != float64(1) {
+		t.Errorf("stopped on entry at line %v, want 1", got)
+	}
+	client.request("next", map[string]any{"threadId": 1})
+	if stopped := client.event("stopped"); stopped["reason"] != "step" {
+		t.Errorf("stopped for %v, want step", stopped["reason"])
+	}
+	if got := line(); got != float64(11) {
+		t.Errorf("stepped to line %v, want 11", got)
+	}
+	client.request("terminate", nil)
+	client.event("terminated")
+}
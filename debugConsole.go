@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// debugConsole is the command line frontend of the debugger, used by
+// lox debug.
+type debugConsole struct {
+	debugger    *Debugger
+	in          *bufio.Reader
+	out         io.Writer
+	selected    int
+	lastCommand string
+	sources     map[string][]string
+}
+
+func newDebugConsole(in *bufio.Reader, out io.Writer) *Debugger {
+	var console = &debugConsole{in: in, out: out, sources: map[string][]string{}}
+	console.debugger = newDebugger(console.pause)
+	return console.debugger
+}
+
+// pause reads and runs commands until one of them resumes execution.
+func (c *debugConsole) pause(i *Interpreter, reason string) {
+	c.selected = len(c.debugger.stack) - 1
+	var frame = c.debugger.stack[c.selected]
+	fmt.Fprintf(c.out, "Paused at %s:%d (%s)\n", displayPath(frame.module.path), frame.line, reason)
+	c.showLine(frame.module.path, frame.line)
+	for {
+		fmt.Fprint(c.out, "(lox) ")
+		input, err := c.in.ReadString('\n')
+		if err != nil && input == "" {
+			// Without a user to drive it, let the script run to the end.
+			c.debugger.detach()
+			return
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			input = c.lastCommand
+		}
+		c.lastCommand = input
+		if c.command(i, input) {
+			return
+		}
+	}
+}
+
+// command runs one debugger command and reports whether execution resumes.
+func (c *debugConsole) command(i *Interpreter, input string) bool {
+	var d = c.debugger
+	var name, argument, _ = strings.Cut(input, " ")
+	argument = strings.TrimSpace(argument)
+	switch name {
+	case "continue", "c":
+		d.resume(RUN)
+		return true
+	case "step", "s":
+		d.resume(STEP_INTO)
+		return true
+	case "next", "n":
+		d.resume(STEP_OVER)
+		return true
+	case "finish", "out":
+		d.resume(STEP_OUT)
+		return true
+	case "break", "b":
+		c.setBreakpoint(i, argument, true)
+	case "delete", "clear":
+		c.setBreakpoint(i, argument, false)
+	case "breakpoints", "info":
+		c.listBreakpoints()
+	case "backtrace", "bt", "where":
+		c.backtrace(i)
+	case "frame", "f":
+		index, err := strconv.Atoi(argument)
+		if err != nil || index < 0 || index >= len(d.stack) || d.stack[len(d.stack)-1-index].module == nil {
+			fmt.Fprintln(c.out, "No such frame.")
+			break
+		}
+		c.selected = len(d.stack) - 1 - index
+		var frame = d.stack[c.selected]
+		c.showLine(frame.module.path, frame.line)
+	case "locals":
+		c.locals(i)
+	case "globals":
+		c.globals(i)
+	case "print", "p":
+		fmt.Fprintln(c.out, d.evaluate(i, d.stack[c.selected], argument))
+	case "list", "l":
+		var frame = d.stack[c.selected]
+		for line := frame.line - 5; line <= frame.line+5; line++ {
+			c.showLine(frame.module.path, line)
+		}
+	case "quit", "q":
+		d.detach()
+		i.cancel(errDebuggerQuit)
+	case "help", "h":
+		fmt.Fprint(c.out, debuggerHelp)
+	default:
+		fmt.Fprintln(c.out, "Unknown command '"+name+"'. Type 'help' for a list of commands.")
+	}
+	return false
+}
+
+const debuggerHelp = `break [file:]line | function   set a breakpoint (b)
+delete [file:]line | function  remove a breakpoint (clear)
+breakpoints                    list breakpoints
+continue                       run to the next breakpoint (c)
+step                           step into calls (s)
+next                           step over calls (n)
+finish                         run until the current function returns (out)
+backtrace                      show the call stack (bt)
+frame N                        select frame N of the backtrace (f)
+locals                         show the variables of the selected frame
+globals                        show the globals of the selected frame's module
+print EXPR                     evaluate an expression in the selected frame (p)
+list                           show the source around the selected frame (l)
+quit                           stop the script (q)
+`
+
+// setBreakpoint parses "line", "file:line" or a function name. A bare line
+// refers to the script being debugged.
+func (c *debugConsole) setBreakpoint(i *Interpreter, argument string, set bool) {
+	if argument == "" {
+		fmt.Fprintln(c.out, "Expect a line or a function name.")
+		return
+	}
+	var path, lineText = i.script.path, argument
+	if index := strings.LastIndex(argument, ":"); index >= 0 {
+		path, lineText = argument[:index], argument[index+1:]
+	}
+	line, err := strconv.Atoi(lineText)
+	if err != nil {
+		c.debugger.setFunctionBreakpoint(argument, set)
+		return
+	}
+	c.debugger.setBreakpoint(path, line, set)
+	if set {
+		fmt.Fprintf(c.out, "Breakpoint at %s:%d\n", displayPath(path), line)
+	}
+}
+
+func (c *debugConsole) listBreakpoints() {
+	var entries = []string{}
+	for key := range c.debugger.breakpoints {
+		entries = append(entries, fmt.Sprintf("%s:%d", displayPath(key.path), key.line))
+	}
+	for name := range c.debugger.functionBreakpoints {
+		entries = append(entries, name)
+	}
+	sort.Strings(entries)
+	if len(entries) == 0 {
+		fmt.Fprintln(c.out, "No breakpoints.")
+	}
+	for _, entry := range entries {
+		fmt.Fprintln(c.out, entry)
+	}
+}
+
+func (c *debugConsole) backtrace(i *Interpreter) {
+	var stack = c.debugger.stack
+	for index := len(stack) - 1; index >= 0; index-- {
+		var name = c.debugger.frameName(i, index)
+		var marker = " "
+		if index == c.selected {
+			marker = "*"
+		}
+		var frame = stack[index]
+		if frame.module == nil {
+			fmt.Fprintf(c.out, "%s#%d %s\n", marker, len(stack)-1-index, name)
+			continue
+		}
+		fmt.Fprintf(c.out, "%s#%d %s at %s:%d\n", marker, len(stack)-1-index, name, displayPath(frame.module.path), frame.line)
+	}
+}
+
+// locals shows the variables visible in the selected frame, innermost scope
+// first. Shadowed variables are left out, and the fields of this are shown.
+func (c *debugConsole) locals(i *Interpreter) {
+	var seen = map[string]bool{}
+	for environment := c.debugger.stack[c.selected].environment; environment != nil && environment.values == nil; environment = environment.enclosing {
+		for slot, name := range environment.names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			fmt.Fprintf(c.out, "%s = %s\n", name, c.debugger.show(i, environment.slots[slot]))
+			instance, ok := environment.slots[slot].(*LoxInstance)
+			if name == "this" && ok {
+				var fields = instance.fields()
+				for _, field := range sortedKeys(fields) {
+					fmt.Fprintf(c.out, "  .%s = %s\n", field, c.debugger.show(i, fields[field]))
+				}
+			}
+		}
+	}
+	if len(seen) == 0 {
+		fmt.Fprintln(c.out, "No locals.")
+	}
+}
+
+func (c *debugConsole) globals(i *Interpreter) {
+	var globals = c.debugger.stack[c.selected].module.globals
+	for _, name := range sortedKeys(globals.values) {
+		fmt.Fprintf(c.out, "%s = %s\n", name, c.debugger.show(i, globals.values[name]))
+	}
+}
+
+func (c *debugConsole) showLine(path string, line int) {
+	lines, ok := c.sources[path]
+	if !ok {
+		source, _ := os.ReadFile(path)
+		lines = strings.Split(string(source), "\n")
+		c.sources[path] = lines
+	}
+	if line >= 1 && line <= len(lines) {
+		fmt.Fprintf(c.out, "%5d | %s\n", line, lines[line-1])
+	}
+}
+
+func sortedKeys(values map[string]any) []string {
+	var keys = []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// debugSession runs a script under the debug console, feeding it commands,
+// and returns what the console wrote.
+func debugSession(t *testing.T, source string, commands string, options ...interpreterOption) string {
+	var path = filepath.Join(t.TempDir(), "main.lox")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	var console = newDebugConsole(bufio.NewReader(strings.NewReader(commands)), &out)
+	options = append(options, withHook(console))
+	runCapturedAt(source, path, "", options...)
+	return out.String()
+}
+
+func TestDebugConsoleLocals(t *testing.T) {
+	var output = debugSession(t, `fun f(x) {
+  var a = 1;
+  var b = 2;
+  {
+    var c = 3;
+    var a = 4;
+    print a + b + c + x;
+  }
+}
+f(10);
+`, "b 7\nc\nlocals\nc\n")
+	var want = "(lox) c = 3\na = 4\nx = 10\nb = 2\n(lox) "
+	if !strings.Contains(output, want) {
+		t.Errorf("got %q, want it to contain %q", output, want)
+	}
+}
+
+func TestDebugConsolePrint(t *testing.T) {
+	var output = debugSession(t, "var a = 1;\nprint a;\n", "n\np a + 1\np nil.field\np missing\nc\n")
+	for _, want := range []string{"(lox) 2\n", "(lox) Error: Only instances have properties.\n", "(lox) Error: Undefined variable 'missing'.\n"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("got %q, want it to contain %q", output, want)
+		}
+	}
+}
+
+type panicNative struct{}
+
+func (p *panicNative) arity() int {
+	return 0
+}
+
+func (p *panicNative) call(i *Interpreter, arguments []any) any {
+	panic("interpreter bug")
+}
+
+func (p *panicNative) String() string {
+	return "<native fn>"
+}
+
+// TestDebugConsoleGoPanic checks that a Go panic while evaluating at the
+// prompt isn't shown as a Lox error.
+func TestDebugConsoleGoPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "interpreter bug" {
+			t.Errorf("recovered %v, want the Go panic", r)
+		}
+	}()
+	debugSession(t, "print 1;\n", "p bug()\nc\n", func(i *Interpreter) {
+		i.builtins.define("bug", &panicNative{})
+	})
+	t.Error("the Go panic was hidden")
+}
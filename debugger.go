@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type stepMode int
+
+const (
+	RUN stepMode = iota
+	STEP_INTO
+	STEP_OVER
+	STEP_OUT
+)
+
+var errDebuggerQuit = errors.New("debugger quit")
+
+type breakpoint struct {
+	path string
+	line int
+}
+
+// debugFrame is what the debugger knows about an active call: where it is
+// and the environment its current statement runs in. Frames of natives have
+// no module.
+type debugFrame struct {
+	module      *LoxModule
+	line        int
+	environment *Environment
+}
+
+// Debugger decides when execution stops, from breakpoints and stepping
+// commands, and hands control to its frontend through paused. Execution
+// resumes when paused returns. It starts paused before the first statement
+// so that breakpoints can be set. Breakpoints may be changed from another
+// goroutine while the script runs.
+type Debugger struct {
+	mu                  sync.Mutex
+	breakpoints         map[breakpoint]bool
+	functionBreakpoints map[string]bool
+	mode                stepMode
+	depth               int
+	stack               []debugFrame
+	last                breakpoint
+	lastDepth           int
+	breakNext           bool
+	pauseRequested      bool
+	evaluating          bool
+	paths               map[string]string
+	paused              func(i *Interpreter, reason string)
+}
+
+func newDebugger(paused func(i *Interpreter, reason string)) *Debugger {
+	return &Debugger{
+		breakpoints:         map[breakpoint]bool{},
+		functionBreakpoints: map[string]bool{},
+		mode:                STEP_INTO,
+		paths:               map[string]string{},
+		paused:              paused,
+	}
+}
+
+func (d *Debugger) loaded(i *Interpreter, path string, statements []Stmt) {}
+
+func (d *Debugger) beforeStatement(i *Interpreter, stmt Stmt) {
+	if d.evaluating {
+		return
+	}
+	line, ok := i.lines[stmt]
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	var depth = len(i.frames)
+	for len(d.stack) <= depth {
+		d.stack = append(d.stack, debugFrame{})
+	}
+	d.stack = d.stack[:depth+1]
+	d.stack[depth] = debugFrame{i.module, line, i.environment}
+
+	path, ok := d.paths[i.module.path]
+	if !ok {
+		path = absolutePath(i.module.path)
+		d.paths[i.module.path] = path
+	}
+	var here = breakpoint{path, line}
+	var moved = here != d.last || depth != d.lastDepth
+	d.last, d.lastDepth = here, depth
+	var reason = ""
+	switch {
+	case d.pauseRequested:
+		reason = "pause"
+	case d.breakNext:
+		reason = "function breakpoint"
+	case !moved:
+	case d.breakpoints[here]:
+		reason = "breakpoint"
+	case d.mode == STEP_INTO:
+		reason = "step"
+	case d.mode == STEP_OVER && depth <= d.depth:
+		reason = "step"
+	case d.mode == STEP_OUT && depth < d.depth:
+		reason = "step"
+	}
+	d.breakNext, d.pauseRequested = false, false
+	d.mu.Unlock()
+	if reason != "" {
+		d.paused(i, reason)
+	}
+}
+
+func (d *Debugger) enterFunction(i *Interpreter, function LoxCallable, arguments []any) {
+	lf, ok := function.(*LoxFunction)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.evaluating && d.functionBreakpoints[lf.declaration.name.lexeme] {
+		d.breakNext = true
+	}
+}
+
+func (d *Debugger) exitFunction(i *Interpreter, function LoxCallable, value any) {
+	if _, ok := function.(*LoxFunction); !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakNext = false
+}
+
+func (d *Debugger) branchTaken(i *Interpreter, node any, branch int) {}
+
+func (d *Debugger) assigned(i *Interpreter, name Token, value any) {}
+
+// resume sets how far execution goes before pausing again. Stepping is
+// relative to the innermost frame.
+func (d *Debugger) resume(mode stepMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mode, d.depth = mode, len(d.stack)-1
+}
+
+// requestPause stops the script at the next statement it runs.
+func (d *Debugger) requestPause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pauseRequested = true
+}
+
+// detach removes every breakpoint and lets the script run to the end.
+func (d *Debugger) detach() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mode = RUN
+	d.breakpoints = map[breakpoint]bool{}
+	d.functionBreakpoints = map[string]bool{}
+}
+
+func (d *Debugger) setBreakpoint(path string, line int, set bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var key = breakpoint{absolutePath(path), line}
+	if set {
+		d.breakpoints[key] = true
+	} else {
+		delete(d.breakpoints, key)
+	}
+}
+
+func (d *Debugger) setFunctionBreakpoint(name string, set bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if set {
+		d.functionBreakpoints[name] = true
+	} else {
+		delete(d.functionBreakpoints, name)
+	}
+}
+
+// replaceBreakpoints sets the line breakpoints of one file.
+func (d *Debugger) replaceBreakpoints(path string, lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	path = absolutePath(path)
+	for key := range d.breakpoints {
+		if key.path == path {
+			delete(d.breakpoints, key)
+		}
+	}
+	for _, line := range lines {
+		d.breakpoints[breakpoint{path, line}] = true
+	}
+}
+
+func (d *Debugger) replaceFunctionBreakpoints(names []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.functionBreakpoints = map[string]bool{}
+	for _, name := range names {
+		d.functionBreakpoints[name] = true
+	}
+}
+
+// frameName names the function running in a frame of the stack.
+func (d *Debugger) frameName(i *Interpreter, index int) string {
+	if index == 0 {
+		return "script"
+	}
+	return fmt.Sprint(i.frames[index-1].callee)
+}
+
+// show stringifies a value without stopping at breakpoints in __str__.
+func (d *Debugger) show(i *Interpreter, value any) string {
+	return d.evaluated(i, func() string {
+		return d.quote(i, value)
+	})
+}
+
+// quote stringifies a value, quoting strings so they stand out.
+func (d *Debugger) quote(i *Interpreter, value any) string {
+	if text, ok := value.(string); ok {
+		return strconv.Quote(text)
+	}
+	return i.stringify(value)
+}
+
+// evaluate parses source as an expression and evaluates it in the
+// environment of a paused frame.
+func (d *Debugger) evaluate(i *Interpreter, frame debugFrame, source string) string {
+	expr, ok := parseExpression(source)
+	if !ok {
+		return "Invalid expression."
+	}
+	var resolver = newResolver()
+	resolver.scopes = scopesOf(frame.environment)
+	resolver.currentClass = SUB_CLASS
+	resolver.resolve(expr)
+	var environment, module = i.environment, i.module
+	i.environment = frame.environment
+	i.enterModule(frame.module)
+	defer func() {
+		i.environment = environment
+		i.enterModule(module)
+	}()
+	return d.evaluated(i, func() string {
+		return d.quote(i, i.evaluate(expr))
+	})
+}
+
+// parseExpression parses source as a single expression.
+func parseExpression(source string) (expr Expr, ok bool) {
+	var previousFlag = errorFlag
+	errorFlag = false
+	defer func() {
+		if r := recover(); r != nil {
+			expr, ok = nil, false
+		}
+		errorFlag = previousFlag
+	}()
+	var parser = newParser(newScanner(source).scanTokens())
+	expr = parser.expression()
+	if !parser.isAtEnd() {
+		parser.error(parser.peek(), "Expect end of expression.")
+	}
+	return expr, !errorFlag
+}
+
+// evaluated runs code on behalf of a debugger command. Lox errors are
+// returned as text, and breakpoints are ignored meanwhile.
+func (d *Debugger) evaluated(i *Interpreter, code func() string) (text string) {
+	var depth = len(i.frames)
+	d.evaluating = true
+	defer func() {
+		d.evaluating = false
+		if r := recover(); r != nil {
+			thrown, ok := r.(*loxThrow)
+			if !ok || !thrown.catchable() {
+				panic(r)
+			}
+			i.frames = i.frames[:depth]
+			text = thrown.asError(i).String()
+		}
+	}()
+	return code()
+}
+
+// scopesOf rebuilds the resolver scopes of an environment chain, so that
+// expressions typed at the prompt resolve to the slots of the paused code.
+func scopesOf(environment *Environment) []*scope {
+	var scopes = []*scope{}
+	for ; environment != nil && environment.values == nil; environment = environment.enclosing {
+		var s = &scope{slots: map[string]int{}, defined: map[string]bool{}}
+		for slot, name := range environment.names {
+			s.slots[name] = slot
+			s.defined[name] = true
+		}
+		scopes = append([]*scope{s}, scopes...)
+	}
+	return scopes
+}
+
+func absolutePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return absolute
+}
+
+// displayPath shows paths relative to the working directory when possible.
+func displayPath(path string) string {
+	var wd, err = os.Getwd()
+	if err != nil {
+		return path
+	}
+	relative, err := filepath.Rel(wd, absolutePath(path))
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return path
+	}
+	return relative
+}
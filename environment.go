@@ -1,21 +1,39 @@
 package main
 
+// Environment holds the variables of one scope. Globals live in a map and
+// are looked up by name; locals live in slots numbered by the resolver in
+// the order their scope declares them. The names of the slots are only
+// read by the debugger, so they are only kept when hooks are installed.
 type Environment struct {
 	values    map[string]any
+	slots     []any
+	names     []string
 	enclosing *Environment
 }
 
 func newEnvironment(environment ...*Environment) *Environment {
+	if len(environment) > 0 {
+		return &Environment{nil, nil, nil, environment[0]}
+	}
+	return &Environment{nil, nil, nil, nil}
+}
+
+func newGlobalEnvironment(environment ...*Environment) *Environment {
 	var values = map[string]any{}
 	if len(environment) > 0 {
-		return &Environment{values, environment[0]}
+		return &Environment{values, nil, nil, environment[0]}
 	}
-	return &Environment{values, nil}
+	return &Environment{values, nil, nil, nil}
 }
 
 func (e *Environment) define(name string, value any) {
-	e.values[name] = value
+	if e.values != nil {
+		e.values[name] = value
+		return
+	}
+	e.slots = append(e.slots, value)
 }
+
 func (e *Environment) get(name Token) any {
 	var value, ok = e.values[name.lexeme]
 	if ok {
@@ -41,8 +59,8 @@ func (e *Environment) assign(name Token, value any) {
 	RuntimeError(name, "Undefined variable '"+name.lexeme+"'.")
 }
 
-func (e *Environment) getAt(distance int, name string) any {
-	return e.ancestor(distance).values[name]
+func (e *Environment) getAt(distance int, slot int) any {
+	return e.ancestor(distance).slots[slot]
 }
 
 func (e *Environment) ancestor(distance int) *Environment {
@@ -53,6 +71,6 @@ func (e *Environment) ancestor(distance int) *Environment {
 	return environment
 }
 
-func (e *Environment) assignAt(distance int, name Token, value any) {
-	e.ancestor(distance).values[name.lexeme] = value
+func (e *Environment) assignAt(distance int, slot int, value any) {
+	e.ancestor(distance).slots[slot] = value
 }
@@ -10,6 +10,8 @@ visitBinaryExpr(expr *Binary) any
 visitCallExpr(expr *Call) any
 visitGetExpr(expr *Get) any
 visitGroupingExpr(expr *Grouping) any
+visitIndexExpr(expr *Index) any
+visitInterpolationExpr(expr *Interpolation) any
 visitLiteralExpr(expr *Literal) any
 visitLogicalExpr(expr *Logical) any
 visitSetExpr(expr *Set) any
@@ -22,16 +24,18 @@ visitVariableExpr(expr *Variable) any
 type Assign struct {
 name Token
 value Expr
+local *Local
 }
 
 func (assign_ *Assign) accept(visitor exprVisitor) any {
 return visitor.visitAssignExpr(assign_)
 }
 
-func newAssign(name Token, value Expr, ) *Assign {
+func newAssign(name Token, value Expr, local *Local, ) *Assign {
 	return &Assign{
 name: name,
 value: value,
+local: local,
  }
  }
 type Binary struct {
@@ -71,16 +75,18 @@ arguments: arguments,
 type Get struct {
 object Expr
 name Token
+cache *propertyCache
 }
 
 func (get_ *Get) accept(visitor exprVisitor) any {
 return visitor.visitGetExpr(get_)
 }
 
-func newGet(object Expr, name Token, ) *Get {
+func newGet(object Expr, name Token, cache *propertyCache, ) *Get {
 	return &Get{
 object: object,
 name: name,
+cache: cache,
  }
  }
 type Grouping struct {
@@ -96,6 +102,38 @@ func newGrouping(expression Expr, ) *Grouping {
 expression: expression,
  }
  }
+type Index struct {
+object Expr
+bracket Token
+index Expr
+}
+
+func (index_ *Index) accept(visitor exprVisitor) any {
+return visitor.visitIndexExpr(index_)
+}
+
+func newIndex(object Expr, bracket Token, index Expr, ) *Index {
+	return &Index{
+object: object,
+bracket: bracket,
+index: index,
+ }
+ }
+type Interpolation struct {
+start Token
+parts []Expr
+}
+
+func (interpolation_ *Interpolation) accept(visitor exprVisitor) any {
+return visitor.visitInterpolationExpr(interpolation_)
+}
+
+func newInterpolation(start Token, parts []Expr, ) *Interpolation {
+	return &Interpolation{
+start: start,
+parts: parts,
+ }
+ }
 type Literal struct {
 value any
 }
@@ -130,45 +168,51 @@ type Set struct {
 object Expr
 name Token
 value Expr
+cache *propertyCache
 }
 
 func (set_ *Set) accept(visitor exprVisitor) any {
 return visitor.visitSetExpr(set_)
 }
 
-func newSet(object Expr, name Token, value Expr, ) *Set {
+func newSet(object Expr, name Token, value Expr, cache *propertyCache, ) *Set {
 	return &Set{
 object: object,
 name: name,
 value: value,
+cache: cache,
  }
  }
 type Super struct {
 keyword Token
 method Token
+local *Local
 }
 
 func (super_ *Super) accept(visitor exprVisitor) any {
 return visitor.visitSuperExpr(super_)
 }
 
-func newSuper(keyword Token, method Token, ) *Super {
+func newSuper(keyword Token, method Token, local *Local, ) *Super {
 	return &Super{
 keyword: keyword,
 method: method,
+local: local,
  }
  }
 type This struct {
 keyword Token
+local *Local
 }
 
 func (this_ *This) accept(visitor exprVisitor) any {
 return visitor.visitThisExpr(this_)
 }
 
-func newThis(keyword Token, ) *This {
+func newThis(keyword Token, local *Local, ) *This {
 	return &This{
 keyword: keyword,
+local: local,
  }
  }
 type Unary struct {
@@ -188,15 +232,17 @@ right: right,
  }
 type Variable struct {
 name Token
+local *Local
 }
 
 func (variable_ *Variable) accept(visitor exprVisitor) any {
 return visitor.visitVariableExpr(variable_)
 }
 
-func newVariable(name Token, ) *Variable {
+func newVariable(name Token, local *Local, ) *Variable {
 	return &Variable{
 name: name,
+local: local,
  }
  }
 
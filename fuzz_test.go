@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Each stage of the pipeline must finish with Lox diagnostics at worst,
+// never a Go panic. Run one with, for example:
+//
+//	go test -fuzz FuzzInterpreter
+//
+// Failing inputs are saved by the Go tool under testdata/fuzz.
+
+// addCorpus seeds a fuzz target with the scripts in fuzz/corpus and with
+// inputs that used to crash the interpreter.
+func addCorpus(f *testing.F) {
+	var paths, _ = filepath.Glob(filepath.Join("fuzz", "corpus", "*.lox"))
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(source))
+	}
+	for _, source := range []string{
+		"",
+		`print BigInt(1) << BigInt(100000000000);`,
+		`print Decimal("1e999999999");`,
+		`class S { __str__() { return this; } } print S();`,
+		`print -(-9223372036854775807 - 1);`,
+		`print Error("e");`,
+		`try { while (true) {} } catch (e) { print e; }`,
+		`fun f() { f(); } f();`,
+	} {
+		f.Add(source)
+	}
+}
+
+// discardReports silences the diagnostics of the stages that don't go
+// through run.
+func discardReports(f *testing.F) {
+	var previousOutput = reportOutput
+	reportOutput = io.Discard
+	f.Cleanup(func() {
+		reportOutput = previousOutput
+		errorFlag = false
+	})
+}
+
+func FuzzScanner(f *testing.F) {
+	addCorpus(f)
+	discardReports(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		newScanner(source).scanTokens()
+	})
+}
+
+func FuzzParser(f *testing.F) {
+	addCorpus(f)
+	discardReports(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		newParser(newScanner(source).scanTokens()).parse()
+	})
+}
+
+func FuzzResolver(f *testing.F) {
+	addCorpus(f)
+	discardReports(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		var statements = newParser(newScanner(source).scanTokens()).parse()
+		var resolver = newResolver()
+		resolver.resolve(statements)
+	})
+}
+
+// FuzzInterpreter runs under tight limits, so that inputs that loop or
+// recurse forever end quickly with a Lox error.
+func FuzzInterpreter(f *testing.F) {
+	addCorpus(f)
+	f.Fuzz(func(t *testing.T, source string) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		run(source, "fuzz.lox",
+			withMaxSteps(100000),
+			withMaxCallDepth(200),
+			withMaxAllocation(1<<20),
+			withContext(ctx),
+			withStdout(io.Discard),
+			withStderr(io.Discard),
+			withStdin(strings.NewReader("")),
+		)
+		errorFlag = false
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+)
+
+// hash returns a hash code consistent with isEqual: values that are equal
+// hash alike, so they can be used as keys of hash tables. Numbers hash by
+// exact value, whatever their type. An instance that overloads __eq__ must
+// also define __hash__.
+func (i *Interpreter) hash(site Token, value any) uint64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 2
+	case int64:
+		return hashInt(v)
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return hashInt(int64(v))
+		}
+		return hashFloat(v)
+	case *LoxBigInt, *LoxDecimal:
+		return hashExact(v)
+	case string:
+		return hashString(v)
+	case *LoxInstance:
+		if v.klass.findMethod("__eq__") == nil {
+			return hashPointer(v)
+		}
+		code, ok := i.callMagic(site, v, "__hash__")
+		if !ok {
+			RuntimeError(site, "Instances of "+v.klass.name+" define __eq__ but not __hash__.")
+		}
+		code_int, ok := code.(int64)
+		if !ok {
+			RuntimeError(site, "__hash__ must return an int.")
+		}
+		return hashInt(code_int)
+	}
+	return hashPointer(value)
+}
+
+// hashExact hashes BigInts and Decimals like the int or float of equal value.
+func hashExact(value any) uint64 {
+	var rat, _ = toRat(value)
+	if rat.IsInt() && rat.Num().IsInt64() {
+		return hashInt(rat.Num().Int64())
+	}
+	if float, exact := rat.Float64(); exact {
+		return hashFloat(float)
+	}
+	return hashString(rat.String())
+}
+
+func hashInt(n int64) uint64 {
+	// Mix the bits so that nearby ints spread over the table.
+	var h = uint64(n) * 0x9e3779b97f4a7c15
+	return h ^ (h >> 32)
+}
+
+func hashFloat(f float64) uint64 {
+	return hashInt(int64(math.Float64bits(f)))
+}
+
+func hashString(s string) uint64 {
+	var h = fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// hashPointer hashes objects that compare by identity.
+func hashPointer(value any) uint64 {
+	var pointer = reflect.ValueOf(value)
+	if pointer.Kind() != reflect.Pointer {
+		return hashString(fmt.Sprint(value))
+	}
+	return hashInt(int64(pointer.Pointer()))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const equalitySource = `
+class Point {
+  init(x, y) {
+    this.x = x;
+    this.y = y;
+  }
+}
+var a = Point(1, 2);
+var b = Point(1, 2);
+var big = BigInt("123456789012345678901234567890");
+`
+
+func equalityPairs(b *testing.B) []struct {
+	name        string
+	left, right any
+} {
+	var i = interpretSource(b, equalitySource)
+	return []struct {
+		name        string
+		left, right any
+	}{
+		{"int", int64(3), int64(3)},
+		{"int float", int64(3), 1.5},
+		{"string", "lox", "lox"},
+		{"nil bool", nil, false},
+		{"same instance", global(i, "a"), global(i, "a")},
+		{"distinct instances", global(i, "a"), global(i, "b")},
+		{"BigInt int", global(i, "big"), int64(3)},
+	}
+}
+
+func BenchmarkIsEqual(b *testing.B) {
+	var i = newInterpreter()
+	var site = Token{tokenType: EQUAL_EQUAL, lexeme: "=="}
+	for _, pair := range equalityPairs(b) {
+		b.Run(pair.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				i.isEqual(site, pair.left, pair.right)
+			}
+		})
+	}
+}
+
+// BenchmarkDeepEqual measures the comparison isEqual used to make, for
+// values other than numbers.
+func BenchmarkDeepEqual(b *testing.B) {
+	for _, pair := range equalityPairs(b) {
+		b.Run(pair.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if isNumber(pair.left) && isNumber(pair.right) {
+					numbersEqual(pair.left, pair.right)
+				} else {
+					reflect.DeepEqual(pair.left, pair.right)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	var i = newInterpreter()
+	var site = Token{tokenType: IDENTIFIER, lexeme: "hash"}
+	for _, pair := range equalityPairs(b) {
+		b.Run(pair.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				i.hash(site, pair.left)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+// hook is notified as the interpreter runs, so that tools such as the
+// debugger can follow execution. exitFunction isn't called when a throw
+// unwinds the function; when it ends with a tail call, it is called with the
+// *tailCall as the value before the frame is replaced by the callee's.
+// loaded is called with the code of the script and of every module before it
+// runs. branchTaken is called with an If or a Logical
+// and 0 when the then branch or the right operand runs, 1 otherwise.
+// assigned is called when a variable is declared or assigned.
+type hook interface {
+	loaded(i *Interpreter, path string, statements []Stmt)
+	beforeStatement(i *Interpreter, stmt Stmt)
+	enterFunction(i *Interpreter, function LoxCallable, arguments []any)
+	exitFunction(i *Interpreter, function LoxCallable, value any)
+	branchTaken(i *Interpreter, node any, branch int)
+	assigned(i *Interpreter, name Token, value any)
+}
+
+func withHook(h hook) interpreterOption {
+	return func(i *Interpreter) {
+		i.hooks = append(i.hooks, h)
+	}
+}
+
+// addLines records the lines statements start on, as found by the parser.
+func (i *Interpreter) addLines(lines map[Stmt]int) {
+	for stmt, line := range lines {
+		i.lines[stmt] = line
+	}
+}
+
+func (i *Interpreter) loaded(path string, statements []Stmt) {
+	for _, hook := range i.hooks {
+		hook.loaded(i, path, statements)
+	}
+}
+
+func (i *Interpreter) branchTaken(node any, branch int) {
+	for _, hook := range i.hooks {
+		hook.branchTaken(i, node, branch)
+	}
+}
+
+func (i *Interpreter) assigned(name Token, value any) {
+	for _, hook := range i.hooks {
+		hook.assigned(i, name, value)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+// propertyCache remembers, at one property access, what the last instance
+// seen there had under that name. An instance with the same shape has the
+// same class and field layout, so it finds the property in the same place.
+// For assignments, next is the shape an instance takes when the field is
+// new to it.
+type propertyCache struct {
+	shape  *shape
+	slot   int
+	method *LoxFunction
+	next   *shape
+}
+
+// property looks up a field or a method of an instance. It returns the
+// value of the field, or the method when the instance has no such field.
+func (i *Interpreter) property(instance *LoxInstance, name Token, cache **propertyCache) (any, *LoxFunction) {
+	var c = *cache
+	if c != nil && c.shape == instance.shape {
+		if c.method != nil {
+			return nil, c.method
+		}
+		return instance.values[c.slot], nil
+	}
+	if c == nil {
+		c = &propertyCache{}
+		*cache = c
+	}
+	slot, ok := instance.shape.slots[name.lexeme]
+	if ok {
+		*c = propertyCache{shape: instance.shape, slot: slot}
+		return instance.values[slot], nil
+	}
+	var method = instance.klass.findMethod(name.lexeme)
+	if method == nil {
+		RuntimeError(name, "Undefined property '"+name.lexeme+"'.")
+	}
+	*c = propertyCache{shape: instance.shape, method: method}
+	return nil, method
+}
+
+func (i *Interpreter) setField(instance *LoxInstance, name Token, value any, cache **propertyCache) {
+	var c = *cache
+	if c != nil && c.shape == instance.shape {
+		if c.next != nil {
+			instance.shape = c.next
+			instance.values = append(instance.values, value)
+			return
+		}
+		instance.values[c.slot] = value
+		return
+	}
+	if c == nil {
+		c = &propertyCache{}
+		*cache = c
+	}
+	slot, ok := instance.shape.slots[name.lexeme]
+	if ok {
+		*c = propertyCache{shape: instance.shape, slot: slot}
+		instance.values[slot] = value
+		return
+	}
+	*c = propertyCache{shape: instance.shape, next: instance.shape.with(name.lexeme)}
+	instance.shape = c.next
+	instance.values = append(instance.values, value)
+}
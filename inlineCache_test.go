@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestPropertyCache(t *testing.T) {
+	var tests = []struct {
+		name   string
+		source string
+		stdout string
+	}{
+		{"field shadowing a method after warm-up", `
+class A { m() { return "method"; } }
+fun field() { return "field"; }
+fun call(o) { return o.m(); }
+var a = A();
+var b = A();
+print call(a);
+print call(a);
+a.m = field;
+print call(a);
+print call(b);
+`, "method\nmethod\nfield\nmethod\n"},
+		{"call site seeing several classes", `
+class A { name() { return "A"; } }
+class B { name() { return "B"; } }
+class C < A {}
+class D < A { name() { return "D" + super.name(); } }
+class E { init() { this.name = B().name; } }
+fun describe(o) { return o.name(); }
+var all = "";
+for (var i = 0; i < 3; i = i + 1) {
+  all = all + describe(A()) + describe(B()) + describe(C()) + describe(D()) + describe(E());
+}
+print all;
+`, "ABADABABADABABADAB\n"},
+		{"fields in different layouts", `
+class P {}
+fun x(o) { return o.x; }
+var p = P();
+p.x = 1;
+p.y = 2;
+var q = P();
+q.y = 3;
+q.x = 4;
+print x(p);
+print x(q);
+print x(p);
+`, "1\n4\n1\n"},
+		{"set site seeing several shapes", `
+class P {}
+class Q { init() { this.y = "y"; } }
+fun setX(o, v) { o.x = v; }
+var fresh = P();
+setX(fresh, 1);
+var other = P();
+setX(other, 2);
+setX(other, 3);
+var q = Q();
+setX(q, 4);
+print fresh.x;
+print other.x;
+print q.x + 0;
+print q.y;
+`, "1\n3\n4\ny\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr = runCaptured(test.source, "")
+			if stdout != test.stdout || stderr != "" {
+				t.Errorf("got stdout %q and stderr %q, want stdout %q", stdout, stderr, test.stdout)
+			}
+		})
+	}
+}
+
+const propertyClasses = `
+class Shape {
+  init(size) { this.size = size; }
+  area() { return this.size * this.size; }
+}
+class Square < Shape {}
+class Tile < Square {}
+`
+
+func BenchmarkProperties(b *testing.B) {
+	var sources = []struct {
+		name string
+		loop string
+	}{
+		{"get", "total = total + tile.size;"},
+		{"set", "tile.size = i;"},
+		{"method", "total = total + shape.area();"},
+		{"inherited method", "total = total + tile.area();"},
+	}
+	for _, source := range sources {
+		b.Run(source.name, func(b *testing.B) {
+			var program = propertyClasses + `
+fun run() {
+  var shape = Shape(3);
+  var tile = Tile(3);
+  var total = 0;
+  for (var i = 0; i < 10000; i = i + 1) {
+    ` + source.loop + `
+  }
+}
+run();
+`
+			var statements = newParser(newScanner(program).scanTokens()).parse()
+			var resolver = newResolver()
+			resolver.resolve(statements)
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				newInterpreter(withStdout(io.Discard)).interpret(statements)
+			}
+		})
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"fmt"
-	"reflect"
-	"time"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
 )
 
 type LoxCallable interface {
@@ -12,31 +18,68 @@ type LoxCallable interface {
 }
 
 type Interpreter struct {
+	builtins    *Environment
 	globals     *Environment
 	environment *Environment
-	locals      map[Expr]int
-}
-
-type clockNative struct{}
-
-func (c *clockNative) arity() int {
-	return 0
-}
-
-func (c *clockNative) call(i *Interpreter, arguments []any) any {
-	return float64(time.Now().UnixNano()) / 1e9
-}
-func (c *clockNative) String() string {
-	return "<native fn>"
-}
-
-func newInterpreter() *Interpreter {
-	var globals = newEnvironment()
-	var environment = globals
-
-	globals.define("clock", &clockNative{})
-
-	return &Interpreter{globals, environment, map[Expr]int{}}
+	frames      []callFrame
+	module      *LoxModule
+	script      *LoxModule
+	modules     map[string]*LoxModule
+	importing   []string
+	limits      limits
+	steps       int
+	allocated   int
+	overrun     int
+	line        int
+	ctx         context.Context
+	done        <-chan struct{}
+	deadline    <-chan struct{}
+	stdout      io.Writer
+	stderr      io.Writer
+	stdin       *bufio.Reader
+	lines       map[Stmt]int
+	hooks       []hook
+	optimize    bool
+}
+
+func newInterpreter(options ...interpreterOption) *Interpreter {
+	var builtins = newGlobalEnvironment()
+	builtins.define("clock", &clockNative{})
+	builtins.define("Error", &errorNative{})
+	builtins.define("readLine", &readLineNative{})
+	builtins.define("input", &inputNative{})
+	builtins.define("eprint", &eprintNative{})
+	builtins.define("str", &strNative{})
+	builtins.define("int", &intNative{})
+	builtins.define("float", &floatNative{})
+	builtins.define("div", &divNative{})
+	builtins.define("BigInt", &bigIntNative{})
+	builtins.define("Decimal", &decimalNative{})
+	builtins.define("hash", &hashNative{})
+
+	var module = newLoxModule("", newGlobalEnvironment(builtins))
+	var interpreter = &Interpreter{
+		builtins:    builtins,
+		globals:     module.globals,
+		environment: module.globals,
+		frames:      []callFrame{},
+		module:      module,
+		script:      module,
+		modules:     map[string]*LoxModule{},
+		importing:   []string{},
+		limits:      limits{maxCallDepth: defaultMaxCallDepth},
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		stdin:       bufio.NewReader(os.Stdin),
+		lines:       map[Stmt]int{},
+	}
+	for _, option := range options {
+		option(interpreter)
+	}
+	if interpreter.limits.ctx != nil {
+		interpreter.deadline = interpreter.limits.ctx.Done()
+	}
+	return interpreter
 }
 
 // visit statements
@@ -50,15 +93,14 @@ func (i *Interpreter) visitClassStmt(stmt *Class) any {
 			RuntimeError(stmt.superclass.name, "Superclass must be a class.")
 		}
 	}
-	i.environment.define(stmt.name.lexeme, nil)
 	if stmt.superclass != nil {
 		i.environment = newEnvironment(i.environment)
-		i.environment.define("super", superclass)
+		i.define(i.environment, "super", superclass)
 	}
 	var methods = map[string]*LoxFunction{}
 	for _, method := range stmt.methods {
 		var isInitializer bool = method.name.lexeme == "init"
-		var function *LoxFunction = newLoxFunction(method, i.environment, isInitializer)
+		var function *LoxFunction = newLoxFunction(method, i.environment, isInitializer, i.module)
 		methods[method.name.lexeme] = function
 	}
 	var klass any
@@ -68,15 +110,67 @@ func (i *Interpreter) visitClassStmt(stmt *Class) any {
 		klass = newLoxClass(stmt.name.lexeme, superclass.(*LoxClass), methods)
 		i.environment = i.environment.enclosing
 	}
-	i.environment.assign(stmt.name, klass)
+	i.mixTraits(stmt, klass.(*LoxClass))
+	// Defined last so that locals get their slots in the order the resolver
+	// declared them; methods see the class through their closure.
+	i.define(i.environment, stmt.name.lexeme, klass)
+	return nil
+}
+
+// mixTraits copies the methods of every trait used by the class into it.
+// Lookup order is the class's own methods, then its traits from left to
+// right, then the superclass chain. A method provided by two traits is a
+// conflict unless the class defines it itself.
+func (i *Interpreter) mixTraits(stmt *Class, klass *LoxClass) {
+	var own = map[string]bool{}
+	for name := range klass.methods {
+		own[name] = true
+	}
+	var providers = map[string]*LoxTrait{}
+	for _, traitExpr := range stmt.traits {
+		trait, ok := i.evaluate(traitExpr).(*LoxTrait)
+		if !ok {
+			RuntimeError(traitExpr.name, "Can only use traits with 'with'.")
+			return
+		}
+		// Trait methods see the superclass of the class they are mixed into.
+		var environment = newEnvironment(trait.closure)
+		i.define(environment, "super", klass.superclass)
+		var names = []string{}
+		for name := range trait.methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if previous, ok := providers[name]; ok && !own[name] {
+				RuntimeError(traitExpr.name, "Method '"+name+"' is provided by both "+previous.name+" and "+trait.name+".")
+				return
+			}
+			providers[name] = trait
+			if own[name] {
+				continue
+			}
+			klass.methods[name] = newLoxFunction(trait.methods[name].declaration, environment, name == "init", trait.methods[name].module)
+		}
+	}
+}
+
+func (i *Interpreter) visitTraitStmt(stmt *Trait) any {
+	var methods = map[string]*LoxFunction{}
+	for _, method := range stmt.methods {
+		methods[method.name.lexeme] = newLoxFunction(method, i.environment, false, i.module)
+	}
+	i.define(i.environment, stmt.name.lexeme, newLoxTrait(stmt.name.lexeme, methods, i.environment))
 	return nil
 }
+
 func (i *Interpreter) visitVaStmt(stmt *Va) any {
 	var value any = nil
 	if stmt.initializer != nil {
 		value = i.evaluate(stmt.initializer)
 	}
-	i.environment.define(stmt.name.lexeme, value)
+	i.define(i.environment, stmt.name.lexeme, value)
+	i.assigned(stmt.name, value)
 	return nil
 }
 
@@ -84,22 +178,33 @@ func (i *Interpreter) visitExpressionStmt(stmt *Expression) any {
 	i.evaluate(stmt.expression)
 	return nil
 }
+func (i *Interpreter) visitImportStmt(stmt *Import) any {
+	var module = i.importModule(stmt.path)
+	i.define(i.environment, stmt.name.lexeme, module)
+	return nil
+}
+
 func (i *Interpreter) visitPrintStmt(stmt *Print) any {
 	var value = i.evaluate(stmt.expression)
-	fmt.Println(fmt.Sprint(value))
+	fmt.Fprintln(i.stdout, i.stringify(value))
 	return nil
 }
 
 func (i *Interpreter) visitBlockStmt(stmt *Block) any {
+	i.allocate(environmentSize)
 	return i.executeBlock(stmt.statements, newEnvironment(i.environment))
 }
 
 func (i *Interpreter) visitIfStmt(stmt *If) any {
 	var ret_value any = nil
 	if i.isTruthy(i.evaluate(stmt.condition)) {
+		i.branchTaken(stmt, 0)
 		ret_value = i.execute(stmt.thenBranch)
-	} else if stmt.elseBranch != nil {
-		ret_value = i.execute(stmt.elseBranch)
+	} else {
+		i.branchTaken(stmt, 1)
+		if stmt.elseBranch != nil {
+			ret_value = i.execute(stmt.elseBranch)
+		}
 	}
 	return ret_value
 }
@@ -111,38 +216,96 @@ func (i *Interpreter) visitWhileStmt(stmt *While) any {
 		if ret_value != nil {
 			break
 		}
+		i.checkCancelled()
 	}
 	return ret_value
 }
 
 func (i *Interpreter) visitFunctionStmt(stmt *Function) any {
-	var function = newLoxFunction(stmt, i.environment, false)
-	i.environment.define(stmt.name.lexeme, function)
+	i.allocate(functionSize)
+	var function = newLoxFunction(stmt, i.environment, false, i.module)
+	i.define(i.environment, stmt.name.lexeme, function)
 	return nil
 }
 
 func (i *Interpreter) visitReturnStmt(stmt *Return) any {
+	if stmt.tail {
+		var call = stmt.value.(*Call)
+		var function, receiver, arguments = i.evaluateCall(call)
+		return &returnValue{&tailCall{call.paren, function, receiver, arguments}}
+	}
 	var value any = nil
 	if stmt.value != nil {
 		value = i.evaluate(stmt.value)
 	}
-	return value
+	return &returnValue{value}
+}
+
+func (i *Interpreter) visitThrowStmt(stmt *Throw) any {
+	var value = i.evaluate(stmt.value)
+	panic(&loxThrow{value: value, token: stmt.keyword})
+}
+
+func (i *Interpreter) visitTryStmt(stmt *Try) any {
+	var ret_value, thrown = i.tryBlock(stmt.body, newEnvironment(i.environment))
+	if thrown != nil && stmt.catchName != nil && thrown.catchable() {
+		var environment = newEnvironment(i.environment)
+		i.define(environment, stmt.catchName.lexeme, thrown.value)
+		ret_value, thrown = i.tryBlock(stmt.catchBody, environment)
+	}
+	if stmt.finallyBody != nil {
+		// A return from the finally block replaces any pending return or throw.
+		var finally_value = i.executeBlock(stmt.finallyBody, newEnvironment(i.environment))
+		if finally_value != nil && (thrown == nil || thrown.catchable()) {
+			return finally_value
+		}
+	}
+	if thrown != nil {
+		panic(thrown)
+	}
+	return ret_value
+}
+
+// tryBlock executes a block, recovering from a Lox throw and restoring the
+// interpreter to the state it had when the block was entered.
+func (i *Interpreter) tryBlock(statements []Stmt, environment *Environment) (ret_value any, thrown *loxThrow) {
+	var previous = i.environment
+	var module = i.module
+	var depth = len(i.frames)
+	var importing = len(i.importing)
+	defer func() {
+		if r := recover(); r != nil {
+			t, ok := r.(*loxThrow)
+			if !ok {
+				panic(r)
+			}
+			if err, ok := t.value.(*LoxError); ok {
+				i.fillStack(err)
+			}
+			i.enterModule(module)
+			i.environment = previous
+			i.frames = i.frames[:depth]
+			i.importing = i.importing[:importing]
+			ret_value, thrown = nil, t
+		}
+	}()
+	return i.executeBlock(statements, environment), nil
 }
 
 // visit expressions
 func (i *Interpreter) visitAssignExpr(expr *Assign) any {
 	var value any = i.evaluate(expr.value)
-	distance, ok := i.locals[expr]
-	if ok {
-		i.environment.assignAt(distance, expr.name, value)
+	if expr.local != nil {
+		i.environment.assignAt(expr.local.depth, expr.local.slot, value)
 	} else {
 		i.globals.assign(expr.name, value)
 	}
+	i.assigned(expr.name, value)
 	return value
 }
 
 func (i *Interpreter) visitVariableExpr(expr *Variable) any {
-	return i.lookUpVariable(expr.name, expr)
+	return i.lookUpVariable(expr.name, expr.local)
 }
 
 func (i *Interpreter) visitLiteralExpr(expr *Literal) any {
@@ -153,76 +316,49 @@ func (i *Interpreter) visitGroupingExpr(expr *Grouping) any {
 	return i.evaluate(expr.expression)
 }
 
+func (i *Interpreter) visitInterpolationExpr(expr *Interpolation) any {
+	var builder strings.Builder
+	for _, part := range expr.parts {
+		builder.WriteString(i.stringify(i.evaluate(part)))
+	}
+	i.allocate(builder.Len())
+	return builder.String()
+}
+
 func (i *Interpreter) visitBinaryExpr(expr *Binary) any {
 	var left = i.evaluate(expr.left)
 	var right = i.evaluate(expr.right)
-	var err any = nil
+	result, ok := i.binaryMagic(expr.operator, left, right)
+	if ok {
+		return result
+	}
 	switch expr.operator.tokenType {
-	case GREATER:
-		err = i.checkNumberOperands(expr.operator, left, right)
-		if err != nil {
-			return nil
-		}
-		return left.(float64) > right.(float64)
-	case GREATER_EQUAL:
-		err = i.checkNumberOperands(expr.operator, left, right)
-		if err != nil {
-			return nil
-		}
-		return left.(float64) >= right.(float64)
-	case LESS:
-		err = i.checkNumberOperands(expr.operator, left, right)
-		if err != nil {
-			return nil
-		}
-		return left.(float64) < right.(float64)
-	case LESS_EQUAL:
-		err = i.checkNumberOperands(expr.operator, left, right)
-		if err != nil {
-			return nil
-		}
-		return left.(float64) <= right.(float64)
 	case BANG_EQUAL:
-		return !i.isEqual(left, right)
+		return !i.isEqual(expr.operator, left, right)
 	case EQUAL_EQUAL:
-		return i.isEqual(left, right)
+		return i.isEqual(expr.operator, left, right)
 	case PLUS:
-		var left_num, okl = left.(float64)
-		var right_num, okr = right.(float64)
-		if okl && okr {
-			return left_num + right_num
+		if isNumber(left) && isNumber(right) {
+			return i.arithmetic(expr.operator, left, right)
 		}
 		left_str, okl := left.(string)
 		right_str, okr := right.(string)
 		if okl && okr {
+			i.allocate(len(left_str) + len(right_str))
 			return left_str + right_str
 		}
-		RuntimeError(expr.operator, "Operands "+fmt.Sprint(left)+" and "+fmt.Sprint(right)+" must be two numbers or two strings.")
-	case MINUS:
-		err = i.checkNumberOperands(expr.operator, left, right)
-		if err != nil {
-			return nil
-		}
-		return left.(float64) - right.(float64)
-	case SLASH:
-		err = i.checkNumberOperands(expr.operator, left, right)
-		if err != nil {
-			return nil
-		}
-		return left.(float64) / right.(float64)
-	case STAR:
-		err = i.checkNumberOperands(expr.operator, left, right)
-		if err != nil {
-			return nil
-		}
-		return left.(float64) * right.(float64)
+		RuntimeError(expr.operator, "Operands "+i.stringify(left)+" and "+i.stringify(right)+" must be two numbers or two strings.")
 	}
-	return nil
+	return i.arithmetic(expr.operator, left, right)
 }
 
 func (i *Interpreter) visitUnaryExpr(expr *Unary) any {
 	var right = i.evaluate(expr.right)
 	var err any = nil
+	result, ok := i.callMagic(expr.operator, right, unaryMethods[expr.operator.tokenType])
+	if ok {
+		return result
+	}
 	switch expr.operator.tokenType {
 	case BANG:
 		return !i.isTruthy(right)
@@ -231,7 +367,27 @@ func (i *Interpreter) visitUnaryExpr(expr *Unary) any {
 		if err != nil {
 			return nil
 		}
+		switch v := right.(type) {
+		case int64:
+			if v == math.MinInt64 {
+				integerOverflow(expr.operator)
+			}
+			return -v
+		case *LoxBigInt:
+			return newLoxBigInt(new(big.Int).Neg(v.value))
+		case *LoxDecimal:
+			return newLoxDecimal(new(big.Int).Neg(v.unscaled), v.scale)
+		}
 		return -right.(float64)
+	case TILDE:
+		if v, ok := right.(*LoxBigInt); ok {
+			return newLoxBigInt(new(big.Int).Not(v.value))
+		}
+		right_int, ok := right.(int64)
+		if !ok {
+			RuntimeError(expr.operator, "Operand "+i.stringify(right)+" must be an integer.")
+		}
+		return ^right_int
 	}
 	return nil
 }
@@ -240,13 +396,16 @@ func (i *Interpreter) visitLogicalExpr(expr *Logical) any {
 	var left = i.evaluate(expr.left)
 	if expr.operator.tokenType == OR {
 		if i.isTruthy(left) {
+			i.branchTaken(expr, 1)
 			return left
 		}
 	} else {
 		if !i.isTruthy(left) {
+			i.branchTaken(expr, 1)
 			return left
 		}
 	}
+	i.branchTaken(expr, 0)
 	return i.evaluate(expr.right)
 }
 
@@ -257,27 +416,55 @@ func (i *Interpreter) visitSetExpr(expr *Set) any {
 		RuntimeError(expr.name, "Only instances have fields.")
 	}
 	var value = i.evaluate(expr.value)
-	li_object.set(expr.name, value)
+	i.setField(li_object, expr.name, value, &expr.cache)
 	return value
 }
 
 func (i *Interpreter) visitSuperExpr(expr *Super) any {
-	var distance int = i.locals[expr]
-	var superclass *LoxClass = i.environment.getAt(distance, "super").(*LoxClass)
-	var object *LoxInstance = i.environment.getAt(distance-1, "this").(*LoxInstance)
-	var method *LoxFunction = superclass.findMethod(expr.method.lexeme)
+	// "super" is the only variable of its environment, and "this" is the
+	// first slot of the method environment just inside it.
+	if expr.local == nil {
+		RuntimeError(expr.keyword, "Can't use 'super' outside of a class.")
+	}
+	superclass, _ := i.environment.getAt(expr.local.depth, 0).(*LoxClass)
+	object, ok := i.environment.getAt(expr.local.depth-1, 0).(*LoxInstance)
+	if !ok {
+		RuntimeError(expr.keyword, "Can't use 'super' outside of a method.")
+	}
+	var method *LoxFunction = nil
+	if superclass != nil {
+		method = superclass.findMethod(expr.method.lexeme)
+	}
 	if method == nil {
 		RuntimeError(expr.method, "Undefined property '"+expr.method.lexeme+"'.")
+		return nil
+	}
+	if method.isGetter() {
+		return i.callMethod(expr.method, method, object, []any{})
 	}
 	return method.bind(object)
 }
 
 func (i *Interpreter) visitThisExpr(expr *This) any {
-	return i.lookUpVariable(expr.keyword, expr)
+	return i.lookUpVariable(expr.keyword, expr.local)
 }
 
 func (i *Interpreter) visitCallExpr(expr *Call) any {
-	var callee = i.evaluate(expr.callee)
+	var function, receiver, arguments = i.evaluateCall(expr)
+	return i.callMethod(expr.paren, function, receiver, arguments)
+}
+
+// evaluateCall evaluates the callee and the arguments of a call and checks
+// that they match. A method called right where it is read, as in
+// obj.method(), isn't bound: it comes back with its receiver.
+func (i *Interpreter) evaluateCall(expr *Call) (LoxCallable, *LoxInstance, []any) {
+	var callee any
+	var receiver *LoxInstance
+	if get, ok := expr.callee.(*Get); ok {
+		callee, receiver = i.evaluateMethod(get)
+	} else {
+		callee = i.evaluate(expr.callee)
+	}
 	var arguments = []any{}
 	for _, a := range expr.arguments {
 		arguments = append(arguments, i.evaluate(a.(Expr)))
@@ -285,20 +472,119 @@ func (i *Interpreter) visitCallExpr(expr *Call) any {
 	function, ok := callee.(LoxCallable)
 	if !ok {
 		RuntimeError(expr.paren, "Can only call functions and classes.")
-		return nil
+		return nil, nil, nil
 	}
 	if len(arguments) != function.arity() {
 		RuntimeError(expr.paren, fmt.Sprintf("Expected %d arguments but got %d.", function.arity(), len(arguments)))
-		return nil
+		return nil, nil, nil
 	}
-	return function.call(i, arguments)
+	return function, receiver, arguments
 }
 
-func (i *Interpreter) visitGetExpr(expr *Get) any {
+func (i *Interpreter) evaluateMethod(expr *Get) (any, *LoxInstance) {
 	var object = i.evaluate(expr.object)
+	instance, ok := object.(*LoxInstance)
+	if !ok {
+		return i.getProperty(expr, object), nil
+	}
+	value, method := i.property(instance, expr.name, &expr.cache)
+	if method == nil {
+		return value, nil
+	}
+	if method.isGetter() {
+		return i.callMethod(expr.name, method, instance, []any{}), nil
+	}
+	return method, instance
+}
+
+// tailCall is what a function returns instead of a value when it ends by
+// calling another function. callMethod makes that call in its place.
+type tailCall struct {
+	site      Token
+	function  LoxCallable
+	receiver  *LoxInstance
+	arguments []any
+}
+
+// callFunction calls a function on behalf of the code at site.
+func (i *Interpreter) callFunction(site Token, function LoxCallable, arguments []any) any {
+	return i.callMethod(site, function, nil, arguments)
+}
+
+// callMethod calls a function, as a method of receiver when it isn't nil,
+// keeping the call stack and the interpreter limits up to date. Tail calls
+// reuse the frame, so they don't grow the Go stack.
+func (i *Interpreter) callMethod(site Token, function LoxCallable, receiver *LoxInstance, arguments []any) any {
+	i.checkCancelled()
+	i.checkCallDepth(site)
+	i.frames = append(i.frames, callFrame{function, site.line, receiver})
+	var value = invoke(i, function, receiver, arguments)
+	for {
+		tail, ok := value.(*tailCall)
+		if !ok {
+			break
+		}
+		i.checkCancelled()
+		i.frames[len(i.frames)-1] = callFrame{tail.function, tail.site.line, tail.receiver}
+		value = invoke(i, tail.function, tail.receiver, tail.arguments)
+	}
+	i.frames = i.frames[:len(i.frames)-1]
+	return value
+}
+
+// invoke calls a function. Lox functions notify hooks themselves; invoke
+// does it for the others, such as natives and classes.
+func invoke(i *Interpreter, function LoxCallable, receiver *LoxInstance, arguments []any) any {
+	method, ok := function.(*LoxFunction)
+	if ok && receiver != nil {
+		return method.invoke(i, receiver, arguments)
+	}
+	if ok || len(i.hooks) == 0 {
+		return function.call(i, arguments)
+	}
+	for _, hook := range i.hooks {
+		hook.enterFunction(i, function, arguments)
+	}
+	var value = function.call(i, arguments)
+	for _, hook := range i.hooks {
+		hook.exitFunction(i, function, value)
+	}
+	return value
+}
+
+func (i *Interpreter) visitIndexExpr(expr *Index) any {
+	var object = i.evaluate(expr.object)
+	var index = i.evaluate(expr.index)
+	result, ok := i.callMagic(expr.bracket, object, "__index__", index)
+	if !ok {
+		RuntimeError(expr.bracket, "Only instances with an __index__ method can be indexed.")
+	}
+	return result
+}
+
+func (i *Interpreter) visitGetExpr(expr *Get) any {
+	return i.getProperty(expr, i.evaluate(expr.object))
+}
+
+func (i *Interpreter) getProperty(expr *Get, object any) any {
 	li_object, ok := object.(*LoxInstance)
 	if ok {
-		return li_object.get(expr.name)
+		value, method := i.property(li_object, expr.name, &expr.cache)
+		if method == nil {
+			return value
+		}
+		if method.isGetter() {
+			return i.callMethod(expr.name, method, li_object, []any{})
+		}
+		return method.bind(li_object)
+	}
+	err_object, ok := object.(*LoxError)
+	if ok {
+		return err_object.get(expr.name)
+	}
+	module_object, ok := object.(*LoxModule)
+	if ok {
+		return module_object.get(expr.name)
 	}
 	RuntimeError(expr.name, "Only instances have properties.")
 	return nil
@@ -309,8 +595,25 @@ func (i *Interpreter) evaluate(expr Expr) any {
 	return expr.accept(i)
 }
 
-func (i *Interpreter) isEqual(a, b any) bool {
-	return reflect.DeepEqual(a, b)
+// isEqual compares primitives by value and objects by identity, unless an
+// instance defines __eq__.
+func (i *Interpreter) isEqual(site Token, a, b any) bool {
+	if isNumber(a) && isNumber(b) {
+		return numbersEqual(a, b)
+	}
+	_, aInstance := a.(*LoxInstance)
+	_, bInstance := b.(*LoxInstance)
+	if !aInstance && !bInstance {
+		return a == b
+	}
+	result, ok := i.callMagic(site, a, "__eq__", b)
+	if !ok {
+		result, ok = i.callMagic(site, b, "__eq__", a)
+	}
+	if ok {
+		return i.isTruthy(result)
+	}
+	return a == b
 }
 
 func (i *Interpreter) isTruthy(object any) bool {
@@ -325,32 +628,64 @@ func (i *Interpreter) isTruthy(object any) bool {
 }
 
 func (i *Interpreter) checkNumberOperands(operator Token, left any, right any) any {
-	var _, okl = left.(float64)
-	var _, okr = right.(float64)
-	if okl && okr {
+	if isNumber(left) && isNumber(right) {
 		return nil
 	}
-	RuntimeError(operator, "Operands "+fmt.Sprint(left)+" and "+fmt.Sprint(right)+" must be numbers.")
+	RuntimeError(operator, "Operands "+i.stringify(left)+" and "+i.stringify(right)+" must be numbers.")
 	return "error"
 }
 
 func (i *Interpreter) checkNumberOperand(operator Token, operand any) any {
-	var _, ok = operand.(float64)
-	if ok {
+	if isNumber(operand) {
 		return nil
 	}
-	RuntimeError(operator, "Operand "+fmt.Sprint(operand)+" must be a number.")
+	RuntimeError(operator, "Operand "+i.stringify(operand)+" must be a number.")
 	return "error"
 }
 
-func (i *Interpreter) interpret(statements []Stmt) {
+func (i *Interpreter) interpret(statements []Stmt) (err error) {
+	var module = i.module
+	i.steps, i.allocated, i.overrun, i.line = 0, 0, 0, 0
+	defer func() {
+		if r := recover(); r != nil {
+			thrown, ok := r.(*loxThrow)
+			if !ok {
+				panic(r)
+			}
+			i.enterModule(module)
+			i.environment = i.globals
+			if cancelled, ok := thrown.value.(*CancelledError); ok {
+				err = cancelled
+			} else {
+				var loxErr = thrown.asError(i)
+				i.fillStack(loxErr)
+				err = loxErr
+			}
+			i.frames = i.frames[:0]
+			i.importing = i.importing[:0]
+		}
+	}()
 	for _, statement := range statements {
 		i.execute(statement)
 	}
 	// fmt.Println(fmt.Sprint(value))
+	return nil
+}
+
+// define adds a variable to an environment. The names of slots are only
+// kept for hooks, such as the debugger, that show variables by name.
+func (i *Interpreter) define(environment *Environment, name string, value any) {
+	environment.define(name, value)
+	if len(i.hooks) > 0 && environment.values == nil {
+		environment.names = append(environment.names, name)
+	}
 }
 
 func (i *Interpreter) execute(stmt Stmt) any {
+	i.step(stmt)
+	for _, hook := range i.hooks {
+		hook.beforeStatement(i, stmt)
+	}
 	return stmt.accept(i)
 }
 
@@ -369,14 +704,9 @@ func (i *Interpreter) executeBlock(statements []Stmt, env *Environment) any {
 	return ret_value
 }
 
-func (i *Interpreter) resolve(expr Expr, depth int) {
-	i.locals[expr] = depth
-}
-
-func (i *Interpreter) lookUpVariable(name Token, expr Expr) any {
-	var distance, ok = i.locals[expr]
-	if ok {
-		return i.environment.getAt(distance, name.lexeme)
+func (i *Interpreter) lookUpVariable(name Token, local *Local) any {
+	if local != nil {
+		return i.environment.getAt(local.depth, local.slot)
 	} else {
 		return i.globals.get(name)
 	}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// interpretSource runs a script on a fresh interpreter and returns it, so
+// that tests can inspect the globals it defined.
+func interpretSource(tb testing.TB, source string, options ...interpreterOption) *Interpreter {
+	tb.Helper()
+	var interpreter = newInterpreter(append([]interpreterOption{withStdout(io.Discard)}, options...)...)
+	if err := interpreter.interpret(compile(tb, interpreter, source)); err != nil {
+		tb.Fatalf("runtime error in %q: %v", source, err)
+	}
+	return interpreter
+}
+
+// compile parses and resolves a script to be run by an interpreter.
+func compile(tb testing.TB, interpreter *Interpreter, source string) []Stmt {
+	tb.Helper()
+	errorFlag = false
+	var parser = newParser(newScanner(source).scanTokens())
+	var statements = parser.parse()
+	var resolver = newResolver()
+	resolver.resolve(statements)
+	if errorFlag {
+		errorFlag = false
+		tb.Fatalf("compile error in %q", source)
+	}
+	interpreter.addLines(parser.lines)
+	return statements
+}
+
+func global(i *Interpreter, name string) any {
+	return i.globals.get(Token{tokenType: IDENTIFIER, lexeme: name})
+}
+
+// TestTailCalls runs with a call depth limit far below the recursion depth,
+// which only calls in tail position stay within.
+func TestTailCalls(t *testing.T) {
+	var tests = []struct {
+		name   string
+		source string
+		stdout string
+	}{
+		{"self", `
+fun count(n) { if (n == 0) return "done"; return count(n - 1); }
+print count(100000);
+`, "done\n"},
+		{"mutual", `
+fun even(n) { if (n == 0) return true; return odd(n - 1); }
+fun odd(n) { if (n == 0) return false; return even(n - 1); }
+print even(100000);
+print odd(100001);
+`, "true\ntrue\n"},
+		{"method", `
+class Counter {
+  init() { this.steps = 0; }
+  run(n) { if (n == 0) return this.steps; this.steps = this.steps + 1; return this.run(n - 1); }
+}
+print Counter().run(100000);
+`, "100000\n"},
+		{"finally runs after the call in try", `
+fun unwind(n) {
+  if (n == 0) return "base";
+  try { return unwind(n - 1); } finally { print n; }
+}
+print unwind(3);
+`, "1\n2\n3\nbase\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr = runCaptured(test.source, "", withMaxCallDepth(100))
+			if stdout != test.stdout || stderr != "" {
+				t.Errorf("got stdout %q and stderr %q, want stdout %q", stdout, stderr, test.stdout)
+			}
+		})
+	}
+}
+
+// TestCallsNotInTailPosition checks that calls inside try, or whose result
+// is used, still count against the call depth.
+func TestCallsNotInTailPosition(t *testing.T) {
+	for _, source := range []string{
+		`fun f(n) { if (n == 0) return 0; try { return f(n - 1); } catch (e) { throw e; } } print f(1000);`,
+		`fun f(n) { if (n == 0) return 0; try { return f(n - 1); } finally {} } print f(1000);`,
+		`fun f(n) { if (n == 0) return 0; return 1 + f(n - 1); } print f(1000);`,
+	} {
+		var stdout, stderr = runCaptured(source, "", withMaxCallDepth(100))
+		if stdout != "" || !strings.Contains(stderr, "Maximum call depth exceeded.") {
+			t.Errorf("%s: got stdout %q and stderr %q", source, stdout, stderr)
+		}
+	}
+}
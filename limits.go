@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// limits bound the resources a script may use. Zero means unlimited.
+type limits struct {
+	maxSteps      int
+	maxCallDepth  int
+	maxAllocation int
+	ctx           context.Context
+}
+
+type interpreterOption func(*Interpreter)
+
+// Deep recursion grows the Go stack, so the call depth is bounded by default
+// to fail with a Lox error well before the Go runtime aborts the process.
+const defaultMaxCallDepth = 100000
+
+// Approximate sizes, in bytes, charged against the allocation limit.
+const (
+	environmentSize = 64
+	instanceSize    = 64
+	functionSize    = 48
+)
+
+// Once a limit is exceeded, the handlers that catch the error get this many
+// more steps before the run is cancelled.
+const limitHeadroom = 1000
+
+var (
+	errStepLimit       = errors.New("step limit exceeded")
+	errAllocationLimit = errors.New("allocation limit exceeded")
+)
+
+func withMaxSteps(steps int) interpreterOption {
+	return func(i *Interpreter) {
+		i.limits.maxSteps = steps
+	}
+}
+
+func withMaxCallDepth(depth int) interpreterOption {
+	return func(i *Interpreter) {
+		i.limits.maxCallDepth = depth
+	}
+}
+
+func withMaxAllocation(bytes int) interpreterOption {
+	return func(i *Interpreter) {
+		i.limits.maxAllocation = bytes
+	}
+}
+
+// withContext imposes a wall-clock deadline: once ctx is done, every run
+// fails with a catchable error. InterpretContext is the way to cancel a run
+// outright.
+func withContext(ctx context.Context) interpreterOption {
+	return func(i *Interpreter) {
+		i.limits.ctx = ctx
+	}
+}
+
+// step counts a statement against the step limit. When a limit is set, it
+// also records the line of the statement, which is where limit errors are
+// reported.
+func (i *Interpreter) step(stmt Stmt) {
+	i.steps++
+	if i.limits.maxSteps == 0 && i.limits.maxAllocation == 0 && i.deadline == nil {
+		return
+	}
+	if line, ok := i.lines[stmt]; ok {
+		i.line = line
+	}
+	if i.limits.maxSteps > 0 && i.steps > i.limits.maxSteps {
+		i.exceeded("Step limit exceeded.", errStepLimit)
+	}
+}
+
+func (i *Interpreter) checkCallDepth(paren Token) {
+	if i.limits.maxCallDepth > 0 && len(i.frames) >= i.limits.maxCallDepth {
+		RuntimeError(paren, "Maximum call depth exceeded.")
+	}
+}
+
+func (i *Interpreter) allocate(bytes int) {
+	i.allocated += bytes
+	if i.limits.maxAllocation > 0 && i.allocated > i.limits.maxAllocation {
+		i.exceeded("Allocation limit exceeded.", errAllocationLimit)
+	}
+}
+
+// exceeded raises a catchable error at the current statement the first time
+// a limit is exceeded in a run. Limits stay exceeded, so after limitHeadroom
+// more steps the run is cancelled with cause, which can't be caught.
+func (i *Interpreter) exceeded(message string, cause error) {
+	if i.overrun == 0 {
+		i.overrun = i.steps + limitHeadroom
+		RuntimeError(Token{tokenType: IDENTIFIER, line: i.line}, message)
+	}
+	if i.steps > i.overrun {
+		i.cancel(cause)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// loop2000 runs about 2000 statements.
+const loop2000 = `var i = 0; while (i < 1000) { i = i + 1; }`
+
+func TestLimitsApplyPerRun(t *testing.T) {
+	var interpreter = newInterpreter(withMaxSteps(5000), withStdout(io.Discard))
+	var statements = compile(t, interpreter, loop2000)
+	for run := 0; run < 4; run++ {
+		if err := interpreter.interpret(statements); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+	var endless = compile(t, interpreter, `while (true) {}`)
+	for run := 0; run < 2; run++ {
+		var err = interpreter.interpret(endless)
+		if err == nil || err.Error() != "Step limit exceeded." {
+			t.Fatalf("endless run %d: got %v", run, err)
+		}
+	}
+	if err := interpreter.interpret(statements); err != nil {
+		t.Fatalf("run after exceeding the limit: %v", err)
+	}
+}
+
+func TestAllocationLimitAppliesPerRun(t *testing.T) {
+	var interpreter = newInterpreter(withMaxAllocation(100000), withStdout(io.Discard))
+	var statements = compile(t, interpreter, `var s = ""; for (var i = 0; i < 100; i = i + 1) { s = s + "0123456789"; }`)
+	for run := 0; run < 20; run++ {
+		if err := interpreter.interpret(statements); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+}
+
+// TestLimitLines checks that limit errors are reported at the statement
+// that was running, in top-level code as in functions.
+// TestLimitLines checks that limit errors are reported at the statement
+// that was running, in top-level code as in functions.
+func TestLimitLines(t *testing.T) {
+	var tests = []struct {
+		name   string
+		option func() (interpreterOption, context.CancelFunc)
+	}{
+		{"steps", func() (interpreterOption, context.CancelFunc) { return withMaxSteps(1000), func() {} }},
+		{"allocation", func() (interpreterOption, context.CancelFunc) { return withMaxAllocation(100000), func() {} }},
+		{"deadline", func() (interpreterOption, context.CancelFunc) {
+			var ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+			return withContext(ctx), cancel
+		}},
+	}
+	var sources = []struct {
+		source string
+		stdout string
+	}{
+		{`
+print "start";
+var s = "";
+try {
+  while (true) { s = s + "0123456789"; }
+} catch (e) {
+  print e.line;
+}
+`, "start\n5\n"},
+		{`
+fun grow() {
+  var s = "";
+  while (true) { s = s + "0123456789"; }
+}
+try { grow(); } catch (e) { print e.line; print e.stack; }
+`, "4\n[line 4] in <fn grow>\n[line 6] in script\n"},
+	}
+	for _, test := range tests {
+		for index, source := range sources {
+			var option, cancel = test.option()
+			var stdout, stderr = runCaptured(source.source, "", option)
+			cancel()
+			if stdout != source.stdout || stderr != "" {
+				t.Errorf("%s %d: got stdout %q and stderr %q, want stdout %q", test.name, index, stdout, stderr, source.stdout)
+			}
+		}
+	}
+	var _, stderr = runCaptured("print 1;\nvar s = \"\";\nwhile (true) { s = s + \"0123456789\"; }\n", "", withMaxAllocation(100000))
+	if stderr != "error report in line  3 in  somewhere  with message  Allocation limit exceeded.\n    [line 3] in script\n" {
+		t.Errorf("got stderr %q", stderr)
+	}
+}
+
+func TestLimitHeadroom(t *testing.T) {
+	var stdout, _ = runCaptured(`
+try { while (true) {} } catch (e) { print e.message; }
+print "after";
+while (true) {}
+`, "", withMaxSteps(1000))
+	if stdout != "Step limit exceeded.\nafter\n" {
+		t.Errorf("got stdout %q", stdout)
+	}
+	var interpreter = newInterpreter(withMaxSteps(1000), withStdout(io.Discard))
+	var err = interpreter.interpret(compile(t, interpreter, `
+try { while (true) {} } catch (e) {}
+while (true) {}
+`))
+	var cancelled *CancelledError
+	if !errors.As(err, &cancelled) || !errors.Is(err, errStepLimit) {
+		t.Errorf("got %v, want a cancellation for the step limit", err)
+	}
+}
@@ -5,10 +5,11 @@ type LoxClass struct {
 	name       string
 	methods    map[string]*LoxFunction
 	superclass *LoxClass
+	shape      *shape
 }
 
 func newLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction) *LoxClass {
-	return &LoxClass{name: name, methods: methods, superclass: superclass}
+	return &LoxClass{name: name, methods: methods, superclass: superclass, shape: newShape()}
 }
 
 func (lc *LoxClass) String() string {
@@ -16,10 +17,11 @@ func (lc *LoxClass) String() string {
 }
 
 func (lc *LoxClass) call(interpreter *Interpreter, arguments []any) any {
+	interpreter.allocate(instanceSize)
 	var instance *LoxInstance = newLoxInstance(lc)
 	var initializer *LoxFunction = lc.findMethod("init")
 	if initializer != nil {
-		initializer.bind(instance).call(interpreter, arguments)
+		initializer.invoke(interpreter, instance, arguments)
 	}
 	return instance
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LoxError is the value thrown by runtime errors and created by Error().
+type LoxError struct {
+	message string
+	line    int
+	stack   []string
+}
+
+func newLoxError(message string, line int) *LoxError {
+	return &LoxError{message: message, line: line}
+}
+
+func (le *LoxError) String() string {
+	return "Error: " + le.message
+}
+
+func (le *LoxError) Error() string {
+	return le.message
+}
+
+func (le *LoxError) get(name Token) any {
+	switch name.lexeme {
+	case "message":
+		return le.message
+	case "line":
+		return int64(le.line)
+	case "stack":
+		return strings.Join(le.stack, "\n")
+	}
+	RuntimeError(name, "Undefined property '"+name.lexeme+"'.")
+	return nil
+}
+
+// loxThrow unwinds the Go stack from a throw statement or a runtime error
+// up to the nearest enclosing try statement.
+type loxThrow struct {
+	value any
+	token Token
+}
+
+// asError returns the thrown value as an error, wrapping values that are not
+// already errors.
+func (t *loxThrow) asError(i *Interpreter) *LoxError {
+	err, ok := t.value.(*LoxError)
+	if ok {
+		return err
+	}
+	return newLoxError("Uncaught exception "+i.stringify(t.value)+".", t.token.line)
+}
+
+// Stack traces keep the innermost and outermost frames of deep recursions.
+const maxStackFrames = 20
+
+type callFrame struct {
+	callee   LoxCallable
+	line     int
+	receiver *LoxInstance
+}
+
+// fillStack records the active call frames on a thrown error the first time
+// it is caught, before the frames are discarded.
+func (i *Interpreter) fillStack(err *LoxError) {
+	if err.stack != nil {
+		return
+	}
+	var line = err.line
+	err.stack = []string{}
+	for f := len(i.frames) - 1; f >= 0; f-- {
+		var depth = len(i.frames) - 1 - f
+		if depth < maxStackFrames/2 || f < maxStackFrames/2 {
+			err.stack = append(err.stack, fmt.Sprintf("[line %d] in %v", line, i.frames[f].callee))
+		} else if depth == maxStackFrames/2 {
+			err.stack = append(err.stack, fmt.Sprintf("[... %d frames omitted]", len(i.frames)-maxStackFrames))
+		}
+		line = i.frames[f].line
+	}
+	err.stack = append(err.stack, fmt.Sprintf("[line %d] in script", line))
+}
+
+// callSiteError raises a runtime error at the line of the innermost call,
+// for errors that have no token of their own.
+func (i *Interpreter) callSiteError(message string) {
+	RuntimeError(i.callSite(""), message)
+}
+
+// callSite is a token at the line of the innermost call.
+func (i *Interpreter) callSite(lexeme string) Token {
+	var line = 0
+	if len(i.frames) > 0 {
+		line = i.frames[len(i.frames)-1].line
+	}
+	return Token{tokenType: IDENTIFIER, lexeme: lexeme, line: line}
+}
@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+
+func TestTryCatchFinally(t *testing.T) {
+	var tests = []struct {
+		name   string
+		source string
+		stdout string
+	}{
+		{"return from finally overrides a throw", `
+fun f() { try { throw "thrown"; } finally { return "finally"; } }
+print f();
+`, "finally\n"},
+		{"return from finally overrides a return", `
+fun f() { try { return "try"; } finally { return "finally"; } }
+print f();
+`, "finally\n"},
+		{"throw from catch runs finally", `
+fun f() {
+  try { throw "first"; }
+  catch (e) { throw "second after " + e; }
+  finally { print "finally"; }
+}
+try { f(); } catch (e) { print e; }
+`, "finally\nsecond after first\n"},
+		{"runtime error fields", `
+fun inner() { return nil.field; }
+fun outer() { inner(); }
+try { outer(); } catch (e) {
+  print e.message;
+  print e.line;
+  print e.stack;
+}
+`, "Only instances have properties.\n2\n[line 2] in <fn inner>\n[line 3] in <fn outer>\n[line 4] in script\n"},
+		{"Error value", `
+fun f() { throw Error("custom"); }
+try { f(); } catch (e) { print e; print e.message; print e.line; }
+`, "Error: custom\ncustom\n2\n"},
+		{"non-Error values", `
+try { throw 42; } catch (e) { print e + 1; }
+class Oops {}
+try { throw Oops(); } catch (e) { print e; }
+try { throw nil; } catch (e) { print e; }
+`, "43\nOops instance\nnil\n"},
+		{"try in a loop body", `
+var log = "";
+for (var i = 0; i < 4; i = i + 1) {
+  try {
+    if (i == 2) throw i;
+    log = log + "t" + str(i);
+  } catch (e) {
+    log = log + "c" + str(e);
+  } finally {
+    log = log + "f" + str(i) + " ";
+  }
+}
+print log;
+`, "t0f0 t1f1 c2f2 t3f3 \n"},
+		{"return from try in a loop runs finally", `
+fun f() {
+  var i = 0;
+  while (true) {
+    try { if (i == 2) return i; } finally { print "finally " + str(i); }
+    i = i + 1;
+  }
+}
+print f();
+`, "finally 0\nfinally 1\nfinally 2\n2\n"},
+		{"state restored after a throw", `
+fun recurse(n) { if (n == 0) throw "bottom"; return recurse(n - 1) + 1; }
+var x = "outer";
+{
+  var x = "block";
+  try { recurse(5); } catch (e) { print e + " " + x; }
+  print x;
+}
+fun f() { throw "again"; }
+try { f(); } catch (e) { print e; }
+try { nil.field; } catch (e) { print e.stack; }
+`, "bottom block\nblock\nagain\n[line 11] in script\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr = runCaptured(test.source, "")
+			if stdout != test.stdout || stderr != "" {
+				t.Errorf("got stdout %q and stderr %q, want stdout %q", stdout, stderr, test.stdout)
+			}
+		})
+	}
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	var stdout, stderr = runCaptured(`
+fun f() { throw "up"; }
+try { f(); } finally { print "finally"; }
+print "unreachable";
+`, "")
+	if stdout != "finally\n" || stderr == "" {
+		t.Errorf("got stdout %q and stderr %q", stdout, stderr)
+	}
+}
@@ -1,44 +1,74 @@
 package main
 
+// returnValue is what executing a return statement produces. It is never nil,
+// so blocks and loops stop even when the returned value is nil.
+type returnValue struct {
+	value any
+}
+
+// LoxFunction is a function or a method. A method bound to an instance by
+// reading it as a property has a receiver, which becomes "this".
 type LoxFunction struct {
 	declaration   *Function
 	closure       *Environment
 	isInitializer bool
+	module        *LoxModule
+	receiver      *LoxInstance
 }
 
 func (lf *LoxFunction) arity() int {
 	return len(lf.declaration.params)
 }
 
+func (lf *LoxFunction) isGetter() bool {
+	return lf.declaration.isGetter
+}
+
 func (lf *LoxFunction) String() string {
 	return "<fn " + lf.declaration.name.lexeme + ">"
 }
 
 func (lf *LoxFunction) call(i *Interpreter, arguments []any) any {
+	return lf.invoke(i, lf.receiver, arguments)
+}
+
+// invoke runs the function with this as its receiver. Methods keep "this"
+// in the first slot of their environment, before the parameters.
+func (lf *LoxFunction) invoke(i *Interpreter, this *LoxInstance, arguments []any) any {
+	i.allocate(environmentSize)
 	var environment *Environment = newEnvironment(lf.closure)
-	for i := 0; i < len(lf.declaration.params); i++ {
-		var value = arguments[i]
-		environment.define(lf.declaration.params[i].lexeme, value)
+	if this != nil {
+		i.define(environment, "this", this)
 	}
-	var ret_value = i.executeBlock(lf.declaration.body, environment)
-	if ret_value != nil {
-		if lf.isInitializer {
-			return lf.closure.getAt(0, "this")
-		}
-		return ret_value
+	for index, param := range lf.declaration.params {
+		i.define(environment, param.lexeme, arguments[index])
+	}
+	// Globals are looked up in the module that defined the function.
+	for _, hook := range i.hooks {
+		hook.enterFunction(i, lf, arguments)
 	}
+	var module = i.module
+	i.enterModule(lf.module)
+	var ret_value = i.executeBlock(lf.declaration.body, environment)
+	var value any = nil
 	if lf.isInitializer {
-		return lf.closure.getAt(0, "this")
+		value = this
+	} else if ret_value != nil {
+		value = ret_value.(*returnValue).value
 	}
-	return nil
+	i.enterModule(module)
+	for _, hook := range i.hooks {
+		hook.exitFunction(i, lf, value)
+	}
+	return value
 }
 
 func (lf *LoxFunction) bind(instance *LoxInstance) *LoxFunction {
-	var environment *Environment = newEnvironment(lf.closure)
-	environment.define("this", instance)
-	return newLoxFunction(lf.declaration, environment, lf.isInitializer)
+	var bound = newLoxFunction(lf.declaration, lf.closure, lf.isInitializer, lf.module)
+	bound.receiver = instance
+	return bound
 }
 
-func newLoxFunction(declaration *Function, closure *Environment, isInitializer bool) *LoxFunction {
-	return &LoxFunction{declaration: declaration, closure: closure, isInitializer: isInitializer}
+func newLoxFunction(declaration *Function, closure *Environment, isInitializer bool, module *LoxModule) *LoxFunction {
+	return &LoxFunction{declaration: declaration, closure: closure, isInitializer: isInitializer, module: module}
 }
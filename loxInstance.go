@@ -1,36 +1,54 @@
 // class LoxInstance {
 package main
 
+// shape is the layout of an instance's fields: the slot of each field, in
+// the order they were first set. Instances of a class that set the same
+// fields in the same order share a shape, so a shape stands for both the
+// class and the layout, and lookups can be cached per shape.
+type shape struct {
+	slots       map[string]int
+	transitions map[string]*shape
+}
+
+func newShape() *shape {
+	return &shape{slots: map[string]int{}, transitions: map[string]*shape{}}
+}
+
+// with is the shape that results from adding a field.
+func (s *shape) with(name string) *shape {
+	next, ok := s.transitions[name]
+	if ok {
+		return next
+	}
+	next = newShape()
+	for field, slot := range s.slots {
+		next.slots[field] = slot
+	}
+	next.slots[name] = len(s.slots)
+	s.transitions[name] = next
+	return next
+}
+
 type LoxInstance struct {
 	klass  *LoxClass
-	fields map[string]any
+	shape  *shape
+	values []any
 }
 
 func newLoxInstance(klass *LoxClass) *LoxInstance {
-	return &LoxInstance{klass: klass}
+	return &LoxInstance{klass: klass, shape: klass.shape}
 }
 
 func (li *LoxInstance) String() string {
 	return li.klass.name + " instance"
 }
 
-func (li *LoxInstance) get(name Token) any {
-	// if (fields.containsKey(name.lexeme)) {
-	value, ok := li.fields[name.lexeme]
-	if ok {
-		return value
-	}
-	var method = li.klass.findMethod(name.lexeme)
-	if method != nil {
-		return method.bind(li)
+// fields returns a copy of the fields, for tools that list them.
+func (li *LoxInstance) fields() map[string]any {
+	var fields = map[string]any{}
+	for name, slot := range li.shape.slots {
+		fields[name] = li.values[slot]
 	}
-
-	RuntimeError(name, "Undefined property '"+name.lexeme+"'.")
-	return nil
-}
-
-func (li *LoxInstance) set(name Token, value any) any {
-	li.fields[name.lexeme] = value
-	return nil
+	return fields
 }
 
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoxModule is the namespace created by an import. Every module has its own
+// globals, and its exports are the names defined at its top level.
+type LoxModule struct {
+	path    string
+	globals *Environment
+}
+
+func newLoxModule(path string, globals *Environment) *LoxModule {
+	return &LoxModule{path: path, globals: globals}
+}
+
+func (lm *LoxModule) String() string {
+	return "<module " + lm.path + ">"
+}
+
+func (lm *LoxModule) dir() string {
+	if lm.path == "" {
+		return "."
+	}
+	return filepath.Dir(lm.path)
+}
+
+func (lm *LoxModule) get(name Token) any {
+	value, ok := lm.globals.values[name.lexeme]
+	if ok {
+		return value
+	}
+	RuntimeError(name, "Module "+lm.path+" has no export '"+name.lexeme+"'.")
+	return nil
+}
+
+func (i *Interpreter) enterModule(module *LoxModule) {
+	i.module = module
+	i.globals = module.globals
+}
+
+// importModule loads the module at the path held by the token, relative to
+// the directory of the importing module. Modules run once and are cached.
+func (i *Interpreter) importModule(pathToken Token) *LoxModule {
+	var path = pathToken.literal.(string)
+	if native, ok := nativeModules[path]; ok {
+		return i.nativeModule(path, native)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(i.module.dir(), path)
+	}
+	path, _ = filepath.Abs(path)
+	module, ok := i.modules[path]
+	if ok {
+		return module
+	}
+	var chain = i.importing
+	if i.script.path != "" {
+		var root, _ = filepath.Abs(i.script.path)
+		chain = append([]string{root}, i.importing...)
+	}
+	for index, importing := range chain {
+		if importing == path {
+			RuntimeError(pathToken, "Import cycle detected: "+strings.Join(append(chain[index:], path), " -> ")+".")
+		}
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		RuntimeError(pathToken, "Could not read module '"+pathToken.literal.(string)+"'.")
+	}
+
+	var previousFlag = errorFlag
+	errorFlag = false
+	var parser = newParser(newScanner(string(source)).scanTokens())
+	var statements = parser.parse()
+	i.addLines(parser.lines)
+	var resolver = newResolver()
+	resolver.resolve(statements)
+	var failed = errorFlag
+	errorFlag = previousFlag
+	if failed {
+		RuntimeError(pathToken, "Could not compile module '"+pathToken.literal.(string)+"'.")
+	}
+	if i.optimizing() {
+		statements = newOptimizer(i.lines).optimize(statements)
+	}
+	i.loaded(path, statements)
+
+	module = newLoxModule(path, newGlobalEnvironment(i.builtins))
+	var previousModule = i.module
+	var previousEnvironment = i.environment
+	i.importing = append(i.importing, path)
+	i.enterModule(module)
+	i.environment = module.globals
+	for _, statement := range statements {
+		i.execute(statement)
+	}
+	i.enterModule(previousModule)
+	i.environment = previousEnvironment
+	i.importing = i.importing[:len(i.importing)-1]
+	i.modules[path] = module
+	return module
+}
+
+func (i *Interpreter) nativeModule(name string, exports func() map[string]any) *LoxModule {
+	module, ok := i.modules[name]
+	if ok {
+		return module
+	}
+	module = newLoxModule(name, newGlobalEnvironment(i.builtins))
+	for export, value := range exports() {
+		module.globals.define(export, value)
+	}
+	i.modules[name] = module
+	return module
+}
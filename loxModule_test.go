@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeModules writes files, by path relative to a new directory, and
+// returns the directory.
+func writeModules(t *testing.T, files map[string]string) string {
+	var dir = t.TempDir()
+	for name, source := range files {
+		var path = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func runModule(t *testing.T, path string) (string, string) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runCapturedAt(string(source), path, "")
+}
+
+func TestImportRunsOnce(t *testing.T) {
+	var dir = writeModules(t, map[string]string{
+		"main.lox":    "import \"counter.lox\" as a;\nimport \"counter.lox\" as b;\nimport \"other.lox\" as o;\na.increment();\nprint b.increment();\nprint o.count;\n",
+		"other.lox":   "import \"counter.lox\" as c;\nvar count = c.count;\n",
+		"counter.lox": "print \"loading\";\nvar count = 0;\nfun increment() { count = count + 1; return count; }\n",
+	})
+	var stdout, stderr = runModule(t, filepath.Join(dir, "main.lox"))
+	if stdout != "loading\n2\n0\n" || stderr != "" {
+		t.Errorf("got stdout %q and stderr %q", stdout, stderr)
+	}
+}
+
+func TestImportRelativePaths(t *testing.T) {
+	var dir = writeModules(t, map[string]string{
+		"main.lox":      "import \"lib/a.lox\" as a;\nprint a.name;\n",
+		"lib/a.lox":     "import \"b.lox\" as b;\nimport \"../c.lox\" as c;\nvar name = \"a \" + b.name + \" \" + c.name;\n",
+		"lib/b.lox":     "var name = \"b\";\n",
+		"c.lox":         "var name = \"c\";\n",
+		"lib/c.lox":     "var name = \"wrong c\";\n",
+		"lib/lib/b.lox": "var name = \"wrong b\";\n",
+	})
+	var stdout, stderr = runModule(t, filepath.Join(dir, "main.lox"))
+	if stdout != "a b c\n" || stderr != "" {
+		t.Errorf("got stdout %q and stderr %q", stdout, stderr)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	var dir = writeModules(t, map[string]string{
+		"cycle.lox":   "import \"x.lox\" as x;\n",
+		"x.lox":       "import \"y.lox\" as y;\n",
+		"y.lox":       "import \"x.lox\" as x;\n",
+		"self.lox":    "import \"self.lox\" as me;\n",
+		"missing.lox": "import \"lib.lox\" as lib;\nprint lib.name;\nprint lib.other;\n",
+		"lib.lox":     "var name = \"lib\";\n",
+		"absent.lox":  "import \"nowhere.lox\" as n;\n",
+		"broken.lox":  "import \"bad.lox\" as b;\n",
+		"bad.lox":     "var = ;\n",
+		"caught.lox":  "try { import \"nowhere.lox\" as n; } catch (e) { print e.message; }\nimport \"lib.lox\" as lib;\nprint lib.name;\n",
+	})
+	var path = func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	var tests = []struct {
+		script string
+		stdout string
+		stderr string
+	}{
+		{"cycle.lox", "", "error report in line  1 in  somewhere  with message  Import cycle detected: " +
+			path("x.lox") + " -> " + path("y.lox") + " -> " + path("x.lox") + ".\n    [line 1] in script\n"},
+		{"self.lox", "", "error report in line  1 in  somewhere  with message  Import cycle detected: " +
+			path("self.lox") + " -> " + path("self.lox") + ".\n    [line 1] in script\n"},
+		{"missing.lox", "lib\n", "error report in line  3 in  somewhere  with message  Module " +
+			path("lib.lox") + " has no export 'other'.\n    [line 3] in script\n"},
+		{"absent.lox", "", "error report in line  1 in  somewhere  with message  Could not read module 'nowhere.lox'.\n    [line 1] in script\n"},
+		{"caught.lox", "Could not read module 'nowhere.lox'.\nlib\n", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.script, func(t *testing.T) {
+			var stdout, stderr = runModule(t, path(test.script))
+			if stdout != test.stdout || stderr != test.stderr {
+				t.Errorf("got stdout %q and stderr %q, want %q and %q", stdout, stderr, test.stdout, test.stderr)
+			}
+		})
+	}
+	var _, stderr = runModule(t, path("broken.lox"))
+	if want := "Could not compile module 'bad.lox'."; !strings.Contains(stderr, want) {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+type LoxTrait struct {
+	name    string
+	methods map[string]*LoxFunction
+	closure *Environment
+}
+
+func newLoxTrait(name string, methods map[string]*LoxFunction, closure *Environment) *LoxTrait {
+	return &LoxTrait{name: name, methods: methods, closure: closure}
+}
+
+func (lt *LoxTrait) String() string {
+	return lt.name
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync"
 )
 
 const (
@@ -24,6 +29,8 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	COMMA
 	DOT
 	MINUS
@@ -31,6 +38,11 @@ const (
 	SEMICOLON
 	SLASH
 	STAR
+	PERCENT
+	AMPERSAND
+	PIPE
+	CARET
+	TILDE
 
 	// One or two character tokens.
 	BANG
@@ -41,56 +53,81 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	LESS_LESS
+	GREATER_GREATER
 
 	// Literals.
 	IDENTIFIER
 	STRING
+	INTERPOLATION
 	NUMBER
 
 	// Keywords.
 	AND
+	AS
+	CATCH
 	CLASS
 	ELSE
 	FALSE
+	FINALLY
 	FUN
 	FOR
 	IF
+	IMPORT
 	NIL
 	OR
 	PRINT
 	RETURN
 	SUPER
 	THIS
+	THROW
+	TRAIT
 	TRUE
+	TRY
 	VAR
 	WHILE
+	WITH
 	EOF
 )
 
 var keywords = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":     AND,
+	"as":      AS,
+	"catch":   CATCH,
+	"class":   CLASS,
+	"else":    ELSE,
+	"false":   FALSE,
+	"finally": FINALLY,
+	"for":     FOR,
+	"fun":     FUN,
+	"if":      IF,
+	"import":  IMPORT,
+	"nil":     NIL,
+	"or":      OR,
+	"print":   PRINT,
+	"return":  RETURN,
+	"super":   SUPER,
+	"this":    THIS,
+	"throw":   THROW,
+	"trait":   TRAIT,
+	"true":    TRUE,
+	"try":     TRY,
+	"var":     VAR,
+	"while":   WHILE,
+	"with":    WITH,
 }
 
 
 
 var errorFlag = false
 
-func runFile(filepath string) {
+// reportOutput receives compile and runtime error reports. While a script
+// runs, it is the interpreter's stderr.
+var reportOutput io.Writer = os.Stdout
+
+var runMu sync.Mutex
+
+func runFile(filepath string, options ...interpreterOption) {
 	f, err := os.ReadFile(filepath)
 	if err != nil {
 		fmt.Println("error reading from file")
@@ -98,48 +135,73 @@ func runFile(filepath string) {
 	}
 
 	// fmt.Println(f)
-	run(string(f))
+	run(string(f), filepath, options...)
 
 }
 
-func runPrompt() {
-	var reader = bufio.NewReader(os.Stdin)
+func runPrompt(in io.Reader, out io.Writer, options ...interpreterOption) {
+	var reader = bufio.NewReader(in)
+	// Scripts read from the same buffered reader as the prompt.
+	options = append(options, withStdin(reader), withStdout(out))
 	for {
 		var line string
-		fmt.Printf(YELLOW_COLOR + "> " + DEFAULT_COLOR)
-		line, _ = reader.ReadString('\n')
+		fmt.Fprint(out, YELLOW_COLOR+"> "+DEFAULT_COLOR)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			break
+		}
 		line = strings.TrimSpace(line)
 		if line == "exit" {
 			break
 		}
-		run(line)
+		run(line, "", options...)
 
 		errorFlag = false
 	}
 }
 
-func run(source string) {
-	var interpreter = newInterpreter()
+// run runs a script and reports whether it finished without errors. Runs
+// take turns, as errorFlag and reportOutput belong to the run in progress.
+func run(source string, path string, options ...interpreterOption) bool {
+	runMu.Lock()
+	defer runMu.Unlock()
+	errorFlag = false
+	var interpreter = newInterpreter(options...)
+	interpreter.module.path = path
+	var previousOutput = reportOutput
+	reportOutput = interpreter.stderr
+	defer func() {
+		reportOutput = previousOutput
+	}()
 	var scanner = newScanner(source)
 	var tokens = scanner.scanTokens()
 	var parser = newParser(tokens)
 	var statements = parser.parse()
-	var resolver = newResolver(interpreter)
+	interpreter.addLines(parser.lines)
+	var resolver = newResolver()
 	resolver.resolve(statements)
 	if errorFlag {
-		return
+		return false
 	}
+	if interpreter.optimizing() {
+		statements = newOptimizer(interpreter.lines).optimize(statements)
+	}
+	interpreter.loaded(path, statements)
 	if statements != nil {
-		interpreter.interpret(statements)
+		var err = interpreter.interpret(statements)
+		if err != nil && !errors.Is(err, errDebuggerQuit) {
+			reportRuntimeError(err)
+		}
 	}
+	return !errorFlag
 }
 
 func report(line int, where string, message string) {
-	fmt.Println("error report in line ", line, "in", where, "with message ", message)
+	fmt.Fprintln(reportOutput, "error report in line ", line, "in", where, "with message ", message)
 	errorFlag = true
 }
 
-func error(line int, message string) {
+func lineError(line int, message string) {
 	report(line, "", message)
 }
 
@@ -152,18 +214,119 @@ func TokenError(token Token, message string) {
 }
 
 func RuntimeError(token Token, message string) {
-	report(token.line, " somewhere ", message)
+	panic(&loxThrow{value: newLoxError(message, token.line), token: token})
+}
+
+func reportRuntimeError(err error) {
+	loxErr, ok := err.(*LoxError)
+	if !ok {
+		report(0, " somewhere ", err.Error())
+		return
+	}
+	report(loxErr.line, " somewhere ", loxErr.message)
+	for _, frame := range loxErr.stack {
+		fmt.Fprintln(reportOutput, "    "+frame)
+	}
+}
+
+func writeProfile(profiler *Profiler, path string) {
+	profiler.stop()
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	defer f.Close()
+	err = profiler.write(f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func writeCoverage(coverage *Coverage, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	defer f.Close()
+	coverage.writeLcov(f)
+	coverage.writeSummary(os.Stderr)
 }
 
 func main() {
+	var maxSteps = flag.Int("max-steps", 0, "abort after executing this many statements (0 means no limit)")
+	var maxDepth = flag.Int("max-depth", defaultMaxCallDepth, "maximum call depth (0 means no limit)")
+	var maxMemory = flag.Int("max-memory", 0, "approximate allocation limit in bytes (0 means no limit)")
+	var timeout = flag.Duration("timeout", 0, "abort after this much wall-clock time (0 means no limit)")
+	var cpuProfile = flag.String("cpuprofile", "", "write a pprof CPU profile of the script to this file")
+	var coverage = flag.String("coverage", "", "write an lcov coverage report to this file and print a summary")
+	var optimize = flag.Bool("optimize", false, "fold constants and remove dead branches before running (ignored with --coverage, --cpuprofile, --trace, --max-steps, --max-memory and dap)")
+	var trace = flag.String("trace", "", "write a JSON lines execution trace to this file (- for stderr)")
+	flag.Parse()
+
+	var options = []interpreterOption{
+		withMaxSteps(*maxSteps),
+		withMaxCallDepth(*maxDepth),
+		withMaxAllocation(*maxMemory),
+	}
+	if *timeout > 0 {
+		var ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		options = append(options, withContext(ctx))
+	}
+	if *optimize {
+		options = append(options, withOptimizer())
+	}
+	if *cpuProfile != "" {
+		var profiler = newProfiler()
+		options = append(options, withHook(profiler))
+		profiler.start()
+		defer writeProfile(profiler, *cpuProfile)
+	}
+	if *coverage != "" {
+		var recorder = newCoverage()
+		options = append(options, withHook(recorder))
+		defer writeCoverage(recorder, *coverage)
+	}
+	if *trace == "-" {
+		options = append(options, withHook(newTracer(os.Stderr)))
+	} else if *trace != "" {
+		f, err := os.Create(*trace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		var writer = bufio.NewWriter(f)
+		defer writer.Flush()
+		options = append(options, withHook(newTracer(writer)))
+	}
+
+	if flag.NArg() == 0 {
+		runPrompt(os.Stdin, os.Stdout, options...)
+		return
+	}
+
+	if flag.Arg(0) == "dap" && flag.NArg() == 1 {
+		var err = newDapServer(os.Stdin, os.Stdout, options...).serve()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	if len(os.Args) == 1 {
-		runPrompt()
+	if flag.Arg(0) == "debug" && flag.NArg() == 2 {
+		// The debugger and the script share stdin.
+		var reader = bufio.NewReader(os.Stdin)
+		options = append(options, withStdin(reader), withHook(newDebugConsole(reader, os.Stdout)))
+		runFile(flag.Arg(1), options...)
 		return
 	}
 
-	var filepath = os.Args[1]
-	runFile(filepath)
+	var filepath = flag.Arg(0)
+	runFile(filepath, options...)
 
 }
 
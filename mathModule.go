@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// nativeFunction is a native whose behaviour is given by a Go function, for
+// natives that live in native modules.
+type nativeFunction struct {
+	params   int
+	function func(i *Interpreter, arguments []any) any
+}
+
+func (n *nativeFunction) arity() int {
+	return n.params
+}
+
+func (n *nativeFunction) call(i *Interpreter, arguments []any) any {
+	return n.function(i, arguments)
+}
+
+func (n *nativeFunction) String() string {
+	return "<native fn>"
+}
+
+// nativeModules are the modules implemented in Go. They are imported by name,
+// as in import "math" as math;
+var nativeModules = map[string]func() map[string]any{
+	"math": mathModule,
+}
+
+func mathModule() map[string]any {
+	var exports = map[string]any{
+		"round": &nativeFunction{3, mathRound},
+		"format": &nativeFunction{2, func(i *Interpreter, arguments []any) any {
+			return roundArgument(i, arguments[0], arguments[1], HALF_EVEN).String()
+		}},
+		"group": &nativeFunction{2, func(i *Interpreter, arguments []any) any {
+			return groupThousands(roundArgument(i, arguments[0], arguments[1], HALF_EVEN).String())
+		}},
+		"abs":   &nativeFunction{1, mathAbs},
+		"scale": &nativeFunction{1, mathScale},
+	}
+	for name := range roundingModes {
+		exports[strings.ToUpper(name)] = name
+	}
+	return exports
+}
+
+// mathRound rounds to the given number of fractional digits. Floats are
+// rounded exactly and converted back to floats.
+func mathRound(i *Interpreter, arguments []any) any {
+	name, ok := arguments[2].(string)
+	var mode, known = roundingModes[name]
+	if !ok || !known {
+		i.callSiteError("Unknown rounding mode " + i.stringify(arguments[2]) + ".")
+	}
+	var rounded = roundArgument(i, arguments[0], arguments[1], mode)
+	if _, ok := arguments[0].(float64); ok {
+		var float, _ = rounded.rat().Float64()
+		return float
+	}
+	return rounded
+}
+
+func roundArgument(i *Interpreter, value any, places any, mode roundingMode) *LoxDecimal {
+	decimal, ok := toDecimal(value)
+	if _, isString := value.(string); !ok || isString {
+		i.callSiteError("Can't round " + i.stringify(value) + ".")
+	}
+	count, ok := places.(int64)
+	if !ok || count < 0 || count > maxDecimalPlaces {
+		i.callSiteError("Decimal places must be an int between 0 and " + strconv.Itoa(maxDecimalPlaces) + ".")
+	}
+	return decimal.round(int(count), mode)
+}
+
+// groupThousands inserts commas between groups of three whole digits.
+func groupThousands(text string) string {
+	var sign = ""
+	if strings.HasPrefix(text, "-") {
+		sign, text = "-", text[1:]
+	}
+	var whole, fraction, hasFraction = strings.Cut(text, ".")
+	var grouped strings.Builder
+	for index, digit := range whole {
+		if index > 0 && (len(whole)-index)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	if hasFraction {
+		return sign + grouped.String() + "." + fraction
+	}
+	return sign + grouped.String()
+}
+
+func mathAbs(i *Interpreter, arguments []any) any {
+	switch v := arguments[0].(type) {
+	case int64:
+		if v < 0 {
+			return -v
+		}
+		return v
+	case float64:
+		if v < 0 {
+			return -v
+		}
+		return v
+	case *LoxBigInt:
+		return newLoxBigInt(new(big.Int).Abs(v.value))
+	case *LoxDecimal:
+		return newLoxDecimal(new(big.Int).Abs(v.unscaled), v.scale)
+	}
+	i.callSiteError("Operand must be a number.")
+	return nil
+}
+
+func mathScale(i *Interpreter, arguments []any) any {
+	switch v := arguments[0].(type) {
+	case int64, *LoxBigInt:
+		return int64(0)
+	case *LoxDecimal:
+		return int64(v.scale)
+	}
+	i.callSiteError("Operand must be an exact number.")
+	return nil
+}
@@ -22,27 +22,33 @@ func (gen *GenerateAst) generate(args []string) {
 	}
 	gen.outputDir = args[0]
 	var expr_list = []string{
-		"Assign : Token name, Expr value",
+		"Assign : Token name, Expr value, *Local local",
 		"Binary : Expr left, Token operator, Expr right",
 		"Call : Expr callee, Token paren, []any arguments",
-		"Get : Expr object, Token name",
+		"Get : Expr object, Token name, *propertyCache cache",
 		"Grouping : Expr expression",
+		"Index : Expr object, Token bracket, Expr index",
+		"Interpolation : Token start, []Expr parts",
 		"Literal : any value",
 		"Logical : Expr left, Token operator, Expr right",
-		"Set : Expr object, Token name, Expr value",
-		"Super : Token keyword, Token method",
-		"This : Token keyword",
+		"Set : Expr object, Token name, Expr value, *propertyCache cache",
+		"Super : Token keyword, Token method, *Local local",
+		"This : Token keyword, *Local local",
 		"Unary : Token operator, Expr right",
-		"Variable : Token name",
+		"Variable : Token name, *Local local",
 	}
 	var stmt_list = []string{
 		"Block : []Stmt statements ",
-		"Class : Token name, *Variable superclass, []*Function methods",
+		"Class : Token name, *Variable superclass, []*Variable traits, []*Function methods",
 		"Expression : Expr expression",
-		"Function : Token name, []Token params, []Stmt body",
+		"Function : Token name, []Token params, []Stmt body, bool isGetter",
 		"If : Expr condition, Stmt thenBranch, Stmt elseBranch",
+		"Import : Token keyword, Token path, Token name",
 		"Print : Expr expression",
-		"Return : Token keyword, Expr value",
+		"Return : Token keyword, Expr value, bool tail",
+		"Throw : Token keyword, Expr value",
+		"Trait : Token name, []*Function methods",
+		"Try : Token keyword, []Stmt body, *Token catchName, []Stmt catchBody, []Stmt finallyBody",
 		"Va : Token name, Expr initializer",
 		"While : Expr condition, Stmt body",
 	}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type clockNative struct{}
+
+func (c *clockNative) arity() int {
+	return 0
+}
+
+func (c *clockNative) call(i *Interpreter, arguments []any) any {
+	return float64(time.Now().UnixNano()) / 1e9
+}
+func (c *clockNative) String() string {
+	return "<native fn>"
+}
+
+type errorNative struct{}
+
+func (e *errorNative) arity() int {
+	return 1
+}
+
+func (e *errorNative) call(i *Interpreter, arguments []any) any {
+	return newLoxError(i.stringify(arguments[0]), i.callSite("").line)
+}
+
+func (e *errorNative) String() string {
+	return "<native fn>"
+}
+
+type readLineNative struct{}
+
+func (r *readLineNative) arity() int {
+	return 0
+}
+
+// call returns the next line of input without its line ending, or nil once
+// the input is exhausted.
+func (r *readLineNative) call(i *Interpreter, arguments []any) any {
+	line, err := i.stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return nil
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func (r *readLineNative) String() string {
+	return "<native fn>"
+}
+
+type inputNative struct{}
+
+func (in *inputNative) arity() int {
+	return 1
+}
+
+func (in *inputNative) call(i *Interpreter, arguments []any) any {
+	fmt.Fprint(i.stdout, i.stringify(arguments[0]))
+	return (&readLineNative{}).call(i, []any{})
+}
+
+func (in *inputNative) String() string {
+	return "<native fn>"
+}
+
+type eprintNative struct{}
+
+func (e *eprintNative) arity() int {
+	return 1
+}
+
+func (e *eprintNative) call(i *Interpreter, arguments []any) any {
+	fmt.Fprintln(i.stderr, i.stringify(arguments[0]))
+	return nil
+}
+
+func (e *eprintNative) String() string {
+	return "<native fn>"
+}
+
+type strNative struct{}
+
+func (s *strNative) arity() int {
+	return 1
+}
+
+func (s *strNative) call(i *Interpreter, arguments []any) any {
+	return i.stringify(arguments[0])
+}
+
+func (s *strNative) String() string {
+	return "<native fn>"
+}
+
+type intNative struct{}
+
+func (n *intNative) arity() int {
+	return 1
+}
+
+// call truncates floats toward zero and parses strings in base 10.
+func (n *intNative) call(i *Interpreter, arguments []any) any {
+	switch v := arguments[0].(type) {
+	case int64:
+		return v
+	case float64:
+		if v != v || v < math.MinInt64 || v >= math.MaxInt64 {
+			i.callSiteError("Can't convert " + i.stringify(v) + " to an int.")
+		}
+		return int64(v)
+	case string:
+		integer, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			i.callSiteError("Can't convert '" + v + "' to an int.")
+		}
+		return integer
+	case *LoxBigInt:
+		if !v.value.IsInt64() {
+			i.callSiteError("Can't convert " + v.String() + " to an int.")
+		}
+		return v.value.Int64()
+	case *LoxDecimal:
+		var integer, _ = toBigInt(v)
+		if !integer.IsInt64() {
+			i.callSiteError("Can't convert " + v.String() + " to an int.")
+		}
+		return integer.Int64()
+	}
+	i.callSiteError("Can't convert " + i.stringify(arguments[0]) + " to an int.")
+	return nil
+}
+
+func (n *intNative) String() string {
+	return "<native fn>"
+}
+
+type floatNative struct{}
+
+func (n *floatNative) arity() int {
+	return 1
+}
+
+func (n *floatNative) call(i *Interpreter, arguments []any) any {
+	switch v := arguments[0].(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case string:
+		float, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			i.callSiteError("Can't convert '" + v + "' to a float.")
+		}
+		return float
+	case *LoxBigInt, *LoxDecimal:
+		var rat, _ = toRat(v)
+		float, _ := rat.Float64()
+		return float
+	}
+	i.callSiteError("Can't convert " + i.stringify(arguments[0]) + " to a float.")
+	return nil
+}
+
+func (n *floatNative) String() string {
+	return "<native fn>"
+}
+
+type divNative struct{}
+
+func (n *divNative) arity() int {
+	return 2
+}
+
+// call divides ints or BigInts, truncating toward zero, as "/" divides
+// exactly.
+func (n *divNative) call(i *Interpreter, arguments []any) any {
+	return i.integerDivision(i.callSite("div"), arguments[0], arguments[1])
+}
+
+func (n *divNative) String() string {
+	return "<native fn>"
+}
+
+type bigIntNative struct{}
+
+func (n *bigIntNative) arity() int {
+	return 1
+}
+
+func (n *bigIntNative) call(i *Interpreter, arguments []any) any {
+	integer, ok := toBigInt(arguments[0])
+	if !ok {
+		i.callSiteError("Can't convert " + i.stringify(arguments[0]) + " to a BigInt.")
+	}
+	return newLoxBigInt(integer)
+}
+
+func (n *bigIntNative) String() string {
+	return "<native fn>"
+}
+
+type decimalNative struct{}
+
+func (n *decimalNative) arity() int {
+	return 1
+}
+
+func (n *decimalNative) call(i *Interpreter, arguments []any) any {
+	decimal, ok := toDecimal(arguments[0])
+	if !ok {
+		i.callSiteError("Can't convert " + i.stringify(arguments[0]) + " to a Decimal.")
+	}
+	return decimal
+}
+
+func (n *decimalNative) String() string {
+	return "<native fn>"
+}
+
+type hashNative struct{}
+
+func (n *hashNative) arity() int {
+	return 1
+}
+
+func (n *hashNative) call(i *Interpreter, arguments []any) any {
+	return int64(i.hash(i.callSite("hash"), arguments[0]))
+}
+
+func (n *hashNative) String() string {
+	return "<native fn>"
+}
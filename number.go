@@ -0,0 +1,190 @@
+package main
+
+import (
+	"math"
+	"math/big"
+)
+
+// Numbers are int64 or float64. Operations on two ints produce an int,
+// except "/", which always divides exactly and produces a float; div() is
+// integer division. Mixing an int with a float promotes the int to a float.
+// BigInt and Decimal operands are handled by bigArithmetic, where "/" on
+// BigInts produces a Decimal.
+
+func isNumber(value any) bool {
+	switch value.(type) {
+	case int64, float64, *LoxBigInt, *LoxDecimal:
+		return true
+	}
+	return false
+}
+
+func toFloat(value any) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return math.NaN()
+}
+
+func (i *Interpreter) arithmetic(operator Token, left any, right any) any {
+	var err = i.checkNumberOperands(operator, left, right)
+	if err != nil {
+		return nil
+	}
+	if isBigNumber(left) || isBigNumber(right) {
+		return i.bigArithmetic(operator, left, right)
+	}
+	left_int, okl := left.(int64)
+	right_int, okr := right.(int64)
+	if okl && okr && operator.tokenType != SLASH {
+		return i.integerArithmetic(operator, left_int, right_int)
+	}
+	return i.floatArithmetic(operator, toFloat(left), toFloat(right))
+}
+
+func (i *Interpreter) integerArithmetic(operator Token, left int64, right int64) any {
+	switch operator.tokenType {
+	case GREATER:
+		return left > right
+	case GREATER_EQUAL:
+		return left >= right
+	case LESS:
+		return left < right
+	case LESS_EQUAL:
+		return left <= right
+	case PLUS:
+		var sum = left + right
+		if (left^sum)&(right^sum) < 0 {
+			integerOverflow(operator)
+		}
+		return sum
+	case MINUS:
+		var difference = left - right
+		if (left^right)&(left^difference) < 0 {
+			integerOverflow(operator)
+		}
+		return difference
+	case STAR:
+		var product = left * right
+		if left != 0 && (product/left != right || (left == -1 && right == math.MinInt64)) {
+			integerOverflow(operator)
+		}
+		return product
+	case PERCENT:
+		if right == 0 {
+			RuntimeError(operator, "Division by zero.")
+		}
+		return left % right
+	case AMPERSAND:
+		return left & right
+	case PIPE:
+		return left | right
+	case CARET:
+		return left ^ right
+	case LESS_LESS, GREATER_GREATER:
+		if right < 0 {
+			RuntimeError(operator, "Shift count can't be negative.")
+		}
+		if operator.tokenType == LESS_LESS {
+			if right >= 64 || (left<<right)>>right != left {
+				integerOverflow(operator)
+			}
+			return left << right
+		}
+		return left >> right
+	}
+	return nil
+}
+
+// integerOverflow fails an operation whose int result doesn't fit in 64
+// bits. BigInt operands never overflow.
+func integerOverflow(operator Token) {
+	RuntimeError(operator, "Integer overflow in '"+operator.lexeme+"', use BigInt for larger numbers.")
+}
+
+// integerDivision divides ints or BigInts, truncating toward zero.
+func (i *Interpreter) integerDivision(operator Token, left any, right any) any {
+	if !isInteger(left) || !isInteger(right) {
+		RuntimeError(operator, "Operands of '"+operator.lexeme+"' must be integers.")
+	}
+	left_int, okl := left.(int64)
+	right_int, okr := right.(int64)
+	if !okl || !okr {
+		var l, _ = toBigInt(left)
+		var r, _ = toBigInt(right)
+		if r.Sign() == 0 {
+			RuntimeError(operator, "Division by zero.")
+		}
+		var quotient = new(big.Int).Quo(l, r)
+		i.allocate(len(quotient.Bits()) * 8)
+		return newLoxBigInt(quotient)
+	}
+	if right_int == 0 {
+		RuntimeError(operator, "Division by zero.")
+	}
+	if left_int == math.MinInt64 && right_int == -1 {
+		integerOverflow(operator)
+	}
+	return left_int / right_int
+}
+
+func isInteger(value any) bool {
+	switch value.(type) {
+	case int64, *LoxBigInt:
+		return true
+	}
+	return false
+}
+
+func (i *Interpreter) floatArithmetic(operator Token, left float64, right float64) any {
+	switch operator.tokenType {
+	case GREATER:
+		return left > right
+	case GREATER_EQUAL:
+		return left >= right
+	case LESS:
+		return left < right
+	case LESS_EQUAL:
+		return left <= right
+	case PLUS:
+		return left + right
+	case MINUS:
+		return left - right
+	case STAR:
+		return left * right
+	case SLASH:
+		return left / right
+	case PERCENT:
+		return math.Mod(left, right)
+	case AMPERSAND, PIPE, CARET, LESS_LESS, GREATER_GREATER:
+		RuntimeError(operator, "Operands of '"+operator.lexeme+"' must be integers.")
+	}
+	return nil
+}
+
+// numbersEqual compares an int and a float exactly, without rounding the
+// int to the nearest float.
+func numbersEqual(a any, b any) bool {
+	if isBigNumber(a) || isBigNumber(b) {
+		return bigEqual(a, b)
+	}
+	a_int, oka := a.(int64)
+	b_int, okb := b.(int64)
+	if oka && okb {
+		return a_int == b_int
+	}
+	if !oka && !okb {
+		return toFloat(a) == toFloat(b)
+	}
+	var integer, float = a_int, toFloat(b)
+	if okb {
+		integer, float = b_int, toFloat(a)
+	}
+	if float != math.Trunc(float) || float < math.MinInt64 || float >= math.MaxInt64 {
+		return false
+	}
+	return int64(float) == integer
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIntegerArithmetic(t *testing.T) {
+	var tests = []struct {
+		source string
+		stdout string
+		stderr string
+	}{
+		{`print 7 / 2;`, "3.5\n", ""},
+		{`print 6 / 3;`, "2.0\n", ""},
+		{`print div(7, 2); print div(-7, 2);`, "3\n-3\n", ""},
+		{`print 1 << 62; print -1 << 63; print 3 << 61; print 1 >> 64; print -8 >> 100;`,
+			"4611686018427387904\n-9223372036854775808\n6917529027641081856\n0\n-1\n", ""},
+		{`print 9223372036854775807 + 1;`, "", "Integer overflow in '+', use BigInt for larger numbers."},
+		{`print -9223372036854775807 - 2;`, "", "Integer overflow in '-', use BigInt for larger numbers."},
+		{`print 4611686018427387904 * 2;`, "", "Integer overflow in '*', use BigInt for larger numbers."},
+		{`print 1 << 63;`, "", "Integer overflow in '<<', use BigInt for larger numbers."},
+		{`print 1 << 64;`, "", "Integer overflow in '<<', use BigInt for larger numbers."},
+		{`print 3 << 62;`, "", "Integer overflow in '<<', use BigInt for larger numbers."},
+		{`print -3 << 62;`, "", "Integer overflow in '<<', use BigInt for larger numbers."},
+		{`print 1 << -1;`, "", "Shift count can't be negative."},
+		{`print BigInt(3) << 62;`, "13835058055282163712\n", ""},
+		{`print BigInt(7) / 2; print 7 / BigInt(2); print BigInt(6) / BigInt(3); print Decimal(7) / 2;`, "3.5\n3.5\n2\n3.5\n", ""},
+		{`print BigInt(1) / 3;`, "0.3333333333333333\n", ""},
+		{`print div(BigInt(7), 2); print div(-7, BigInt(2)); print div(BigInt("100000000000000000000"), 3);`,
+			"3\n-3\n33333333333333333333\n", ""},
+		{`print BigInt(1) / 0;`, "", "Division by zero."},
+		{`print div(BigInt(1), 0);`, "", "Division by zero."},
+	}
+	for _, test := range tests {
+		var stdout, stderr = runCaptured(test.source, "")
+		if stdout != test.stdout {
+			t.Errorf("%s: got stdout %q, want %q", test.source, stdout, test.stdout)
+		}
+		if test.stderr == "" && stderr != "" || !strings.Contains(stderr, test.stderr) {
+			t.Errorf("%s: got stderr %q, want %q", test.source, stderr, test.stderr)
+		}
+	}
+}
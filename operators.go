@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+// Classes overload operators by defining methods with these names. The
+// left operand's method is tried first; when the left operand doesn't
+// overload the operator, the right operand's reflected method is tried.
+// Equality is overloaded with __eq__, which isEqual calls.
+var binaryMethods = map[TokenType]string{
+	PLUS:            "__add__",
+	MINUS:           "__sub__",
+	STAR:            "__mul__",
+	SLASH:           "__div__",
+	PERCENT:         "__mod__",
+	AMPERSAND:       "__and__",
+	PIPE:            "__or__",
+	CARET:           "__xor__",
+	LESS_LESS:       "__lshift__",
+	GREATER_GREATER: "__rshift__",
+	LESS:            "__lt__",
+	LESS_EQUAL:      "__le__",
+	GREATER:         "__gt__",
+	GREATER_EQUAL:   "__ge__",
+}
+
+var reflectedMethods = map[TokenType]string{
+	PLUS:            "__radd__",
+	MINUS:           "__rsub__",
+	STAR:            "__rmul__",
+	SLASH:           "__rdiv__",
+	PERCENT:         "__rmod__",
+	AMPERSAND:       "__rand__",
+	PIPE:            "__ror__",
+	CARET:           "__rxor__",
+	LESS_LESS:       "__rlshift__",
+	GREATER_GREATER: "__rrshift__",
+	LESS:            "__gt__",
+	LESS_EQUAL:      "__ge__",
+	GREATER:         "__lt__",
+	GREATER_EQUAL:   "__le__",
+}
+
+var unaryMethods = map[TokenType]string{
+	MINUS: "__neg__",
+	TILDE: "__invert__",
+}
+
+// binaryMagic applies an overloaded binary operator. It reports false when
+// neither operand overloads it.
+func (i *Interpreter) binaryMagic(operator Token, left any, right any) (any, bool) {
+	_, okl := left.(*LoxInstance)
+	_, okr := right.(*LoxInstance)
+	if !okl && !okr {
+		return nil, false
+	}
+	result, ok := i.callMagic(operator, left, binaryMethods[operator.tokenType], right)
+	if !ok {
+		result, ok = i.callMagic(operator, right, reflectedMethods[operator.tokenType], left)
+	}
+	return result, ok
+}
+
+// callMagic calls the named method when value is an instance whose class
+// defines it.
+func (i *Interpreter) callMagic(site Token, value any, name string, arguments ...any) (any, bool) {
+	instance, ok := value.(*LoxInstance)
+	if !ok || name == "" {
+		return nil, false
+	}
+	var method = instance.klass.findMethod(name)
+	if method == nil {
+		return nil, false
+	}
+	if method.arity() != len(arguments) {
+		RuntimeError(site, fmt.Sprintf("Method %s must take %d arguments but takes %d.", name, len(arguments), method.arity()))
+	}
+	return i.callMethod(site, method, instance, arguments), true
+}
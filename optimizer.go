@@ -0,0 +1,264 @@
+package main
+
+// Optimizer rewrites resolved code into code that behaves the same but does
+// less work: operators whose operands are literals are folded, groupings
+// are dropped, and branches and loops that can never run are removed.
+// Folding is done by the interpreter itself, so results match exactly, and
+// an operation that would fail is left for the script to fail at runtime.
+// The pass is skipped when hooks are installed, so that the debugger,
+// coverage, profiles and traces see every line of the original code, and
+// under step or allocation limits, which the removed and folded code would
+// otherwise no longer count towards.
+type Optimizer struct {
+	interpreter *Interpreter
+	lines       map[Stmt]int
+}
+
+func newOptimizer(lines map[Stmt]int) *Optimizer {
+	return &Optimizer{interpreter: newInterpreter(), lines: lines}
+}
+
+func withOptimizer() interpreterOption {
+	return func(i *Interpreter) {
+		i.optimize = true
+	}
+}
+
+func (i *Interpreter) optimizing() bool {
+	return i.optimize && len(i.hooks) == 0 && i.limits.maxSteps == 0 && i.limits.maxAllocation == 0
+}
+
+func (o *Optimizer) optimize(statements []Stmt) []Stmt {
+	var optimized = []Stmt{}
+	for _, stmt := range statements {
+		stmt = o.statement(stmt)
+		if stmt != nil {
+			optimized = append(optimized, stmt)
+		}
+	}
+	return optimized
+}
+
+// statement returns the optimized statement, or nil when it does nothing.
+func (o *Optimizer) statement(stmt Stmt) Stmt {
+	var optimized, _ = stmt.accept(o).(Stmt)
+	return optimized
+}
+
+// branch optimizes a statement that can't be removed, such as the body of a
+// loop, replacing it with an empty block if it does nothing.
+func (o *Optimizer) branch(stmt Stmt) Stmt {
+	var optimized = o.statement(stmt)
+	if optimized == nil {
+		optimized = newBlock([]Stmt{})
+		o.lines[optimized] = o.lines[stmt]
+	}
+	return optimized
+}
+
+func (o *Optimizer) expression(expr Expr) Expr {
+	return expr.accept(o).(Expr)
+}
+
+// fold replaces an operation on literals with its result.
+func (o *Optimizer) fold(expr Expr) (folded Expr) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*loxThrow); !ok {
+				panic(r)
+			}
+			folded = expr
+		}
+	}()
+	return newLiteral(o.interpreter.evaluate(expr))
+}
+
+func isLiteral(expr Expr) bool {
+	_, ok := expr.(*Literal)
+	return ok
+}
+
+func (o *Optimizer) visitBlockStmt(stmt *Block) any {
+	stmt.statements = o.optimize(stmt.statements)
+	return stmt
+}
+
+func (o *Optimizer) visitClassStmt(stmt *Class) any {
+	for _, method := range stmt.methods {
+		method.body = o.optimize(method.body)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitExpressionStmt(stmt *Expression) any {
+	stmt.expression = o.expression(stmt.expression)
+	return stmt
+}
+
+func (o *Optimizer) visitFunctionStmt(stmt *Function) any {
+	stmt.body = o.optimize(stmt.body)
+	return stmt
+}
+
+func (o *Optimizer) visitIfStmt(stmt *If) any {
+	stmt.condition = o.expression(stmt.condition)
+	condition, ok := stmt.condition.(*Literal)
+	if !ok {
+		stmt.thenBranch = o.branch(stmt.thenBranch)
+		if stmt.elseBranch != nil {
+			stmt.elseBranch = o.branch(stmt.elseBranch)
+		}
+		return stmt
+	}
+	if o.interpreter.isTruthy(condition.value) {
+		return o.statement(stmt.thenBranch)
+	}
+	if stmt.elseBranch != nil {
+		return o.statement(stmt.elseBranch)
+	}
+	return nil
+}
+
+func (o *Optimizer) visitImportStmt(stmt *Import) any {
+	return stmt
+}
+
+func (o *Optimizer) visitPrintStmt(stmt *Print) any {
+	stmt.expression = o.expression(stmt.expression)
+	return stmt
+}
+
+func (o *Optimizer) visitReturnStmt(stmt *Return) any {
+	if stmt.value != nil {
+		stmt.value = o.expression(stmt.value)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitThrowStmt(stmt *Throw) any {
+	stmt.value = o.expression(stmt.value)
+	return stmt
+}
+
+func (o *Optimizer) visitTraitStmt(stmt *Trait) any {
+	for _, method := range stmt.methods {
+		method.body = o.optimize(method.body)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitTryStmt(stmt *Try) any {
+	stmt.body = o.optimize(stmt.body)
+	if stmt.catchBody != nil {
+		stmt.catchBody = o.optimize(stmt.catchBody)
+	}
+	if stmt.finallyBody != nil {
+		stmt.finallyBody = o.optimize(stmt.finallyBody)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitVaStmt(stmt *Va) any {
+	if stmt.initializer != nil {
+		stmt.initializer = o.expression(stmt.initializer)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitWhileStmt(stmt *While) any {
+	stmt.condition = o.expression(stmt.condition)
+	if condition, ok := stmt.condition.(*Literal); ok && !o.interpreter.isTruthy(condition.value) {
+		return nil
+	}
+	stmt.body = o.branch(stmt.body)
+	return stmt
+}
+
+func (o *Optimizer) visitAssignExpr(expr *Assign) any {
+	expr.value = o.expression(expr.value)
+	return expr
+}
+
+func (o *Optimizer) visitBinaryExpr(expr *Binary) any {
+	expr.left = o.expression(expr.left)
+	expr.right = o.expression(expr.right)
+	if isLiteral(expr.left) && isLiteral(expr.right) {
+		return o.fold(expr)
+	}
+	return expr
+}
+
+func (o *Optimizer) visitCallExpr(expr *Call) any {
+	expr.callee = o.expression(expr.callee)
+	for index, argument := range expr.arguments {
+		expr.arguments[index] = o.expression(argument.(Expr))
+	}
+	return expr
+}
+
+func (o *Optimizer) visitGetExpr(expr *Get) any {
+	expr.object = o.expression(expr.object)
+	return expr
+}
+
+func (o *Optimizer) visitGroupingExpr(expr *Grouping) any {
+	return o.expression(expr.expression)
+}
+
+func (o *Optimizer) visitIndexExpr(expr *Index) any {
+	expr.object = o.expression(expr.object)
+	expr.index = o.expression(expr.index)
+	return expr
+}
+
+func (o *Optimizer) visitInterpolationExpr(expr *Interpolation) any {
+	for index, part := range expr.parts {
+		expr.parts[index] = o.expression(part)
+	}
+	return expr
+}
+
+func (o *Optimizer) visitLiteralExpr(expr *Literal) any {
+	return expr
+}
+
+// visitLogicalExpr folds a literal left operand: the expression is either
+// that operand or the right one.
+func (o *Optimizer) visitLogicalExpr(expr *Logical) any {
+	expr.left = o.expression(expr.left)
+	expr.right = o.expression(expr.right)
+	left, ok := expr.left.(*Literal)
+	if !ok {
+		return expr
+	}
+	if o.interpreter.isTruthy(left.value) == (expr.operator.tokenType == OR) {
+		return left
+	}
+	return expr.right
+}
+
+func (o *Optimizer) visitSetExpr(expr *Set) any {
+	expr.object = o.expression(expr.object)
+	expr.value = o.expression(expr.value)
+	return expr
+}
+
+func (o *Optimizer) visitSuperExpr(expr *Super) any {
+	return expr
+}
+
+func (o *Optimizer) visitThisExpr(expr *This) any {
+	return expr
+}
+
+func (o *Optimizer) visitUnaryExpr(expr *Unary) any {
+	expr.right = o.expression(expr.right)
+	if isLiteral(expr.right) {
+		return o.fold(expr)
+	}
+	return expr
+}
+
+func (o *Optimizer) visitVariableExpr(expr *Variable) any {
+	return expr
+}
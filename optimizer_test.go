@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var optimizerScripts = map[string]string{
+	"arithmetic":    `print 1 + 2 * 3; print 7 / 2; print (1 + 2) * 3.5; print -(4 - 6); print 2 < 3 == !false;`,
+	"strings":       `print "a" + "b" + "c"; var x = "x"; print "${1 + 2} ${x}";`,
+	"overflow":      `print 9223372036854775807 + 1;`,
+	"failing fold":  `print "before"; print 1 + "a";`,
+	"dead if":       `if (false) print "no"; if (nil) print "no"; else print "else"; if (1 > 0) print "yes";`,
+	"dead while":    `while (false) print "never"; var i = 0; while (i < 3) { if (false) {} i = i + 1; } print i;`,
+	"logical":       `print nil or "default"; print false and 1; print 1 and 2; var x = "x"; print true and x;`,
+	"nested blocks": `fun f() { if (true) { return 1 + 1; } return 0; } print f(); class C { m() { if (false) return 1; return "m"; } } print C().m();`,
+	"caught":        `try { throw 1 + 1; } catch (e) { print e; } finally { print "finally"; }`,
+}
+
+// TestOptimizerConformance runs every script with and without the optimizer
+// and expects the same output.
+func TestOptimizerConformance(t *testing.T) {
+	var scripts = map[string]string{}
+	for name, source := range optimizerScripts {
+		scripts[name] = source
+	}
+	var paths, _ = filepath.Glob(filepath.Join("fuzz", "corpus", "*.lox"))
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scripts[path] = string(source)
+	}
+	for name, source := range scripts {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr = runCaptured(source, "")
+			var optimizedStdout, optimizedStderr = runCaptured(source, "", withOptimizer())
+			if optimizedStdout != stdout {
+				t.Errorf("optimized stdout %q, want %q", optimizedStdout, stdout)
+			}
+			if optimizedStderr != stderr {
+				t.Errorf("optimized stderr %q, want %q", optimizedStderr, stderr)
+			}
+		})
+	}
+}
+
+// TestOptimizerSkippedUnderLimits checks that removed and folded code still
+// counts towards the limits.
+func TestOptimizerSkippedUnderLimits(t *testing.T) {
+	var tests = []struct {
+		source string
+		option interpreterOption
+	}{
+		{`for (var i = 0; i < 100; i = i + 1) { if (false) {} }`, withMaxSteps(350)},
+		{`var s = "0123456789" + "0123456789" + "0123456789" + "0123456789";`, withMaxAllocation(20)},
+	}
+	for _, test := range tests {
+		var _, stderr = runCaptured(test.source, "", test.option)
+		var _, optimizedStderr = runCaptured(test.source, "", test.option, withOptimizer())
+		if stderr == "" || optimizedStderr != stderr {
+			t.Errorf("%s: got stderr %q optimized and %q not", test.source, optimizedStderr, stderr)
+		}
+	}
+}
+
+// TestOptimizerSkippedWithHooks checks that tools still see dead code.
+func TestOptimizerSkippedWithHooks(t *testing.T) {
+	var out bytes.Buffer
+	runCaptured("print 1;\nif (false) print 2;\nwhile (false) print 3;\n", "",
+		withOptimizer(), withHook(newTracer(&out)))
+	for _, line := range []string{`"line":2`, `"line":3`} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("the trace has no statement at %s:\n%s", line, out.String())
+		}
+	}
+}
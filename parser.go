@@ -2,17 +2,25 @@ package main
 
 // expression → equality ;
 // equality → comparison ( ( "!=" | "==" ) comparison )* ;
-// comparison → term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
+// comparison → bitOr ( ( ">" | ">=" | "<" | "<=" ) bitOr )* ;
+// bitOr → bitXor ( "|" bitXor )* ;
+// bitXor → bitAnd ( "^" bitAnd )* ;
+// bitAnd → shift ( "&" shift )* ;
+// shift → term ( ( "<<" | ">>" ) term )* ;
 // term → factor ( ( "-" | "+" ) factor )* ;
-// factor → unary ( ( "/" | "*" ) unary )* ;
-// unary → ( "!" | "-" ) unary
-// | primary ;
+// factor → unary ( ( "/" | "*" | "%" ) unary )* ;
+// unary → ( "!" | "-" | "~" ) unary
+// | call ;
+// call → primary ( "(" arguments? ")" | "." IDENTIFIER | "[" expression "]" )* ;
 // primary → NUMBER | STRING | "true" | "false" | "nil"
 // | "(" expression ")" ;
 
 type Parser struct {
 	tokens  []Token
 	current int
+	// lines holds the line each statement starts on, for tools such as the
+	// debugger.
+	lines map[Stmt]int
 }
 
 type ParseError struct {
@@ -22,6 +30,7 @@ func newParser(tokens []Token) *Parser {
 	return &Parser{
 		current: 0,
 		tokens:  tokens,
+		lines:   map[Stmt]int{},
 	}
 }
 
@@ -46,6 +55,9 @@ func (p *Parser) peek() Token {
 	return p.tokens[p.current]
 }
 func (p *Parser) previous() Token {
+	if p.current == 0 {
+		return p.tokens[0]
+	}
 	return p.tokens[p.current-1]
 }
 
@@ -86,11 +98,11 @@ func (p *Parser) assignment() Expr {
 		expr_var, ok := expr.(*Variable)
 		if ok {
 			var name Token = expr_var.name
-			return newAssign(name, value)
+			return newAssign(name, value, nil)
 		} else {
 			get, ok := expr.(*Get)
 			if ok {
-				return newSet(get.object, get.name, value)
+				return newSet(get.object, get.name, value, nil)
 			}
 		}
 		TokenError(equals, "Invalid assignment target.")
@@ -134,10 +146,54 @@ func (p *Parser) or() Expr {
 	return expr
 }
 
-// comparison → term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
+// comparison → bitOr ( ( ">" | ">=" | "<" | "<=" ) bitOr )* ;
 func (p *Parser) comparison() Expr {
-	var expr Expr = p.term()
+	var expr Expr = p.bitOr()
 	for p.match(LESS, LESS_EQUAL, GREATER, GREATER_EQUAL) {
+		var operator Token = p.previous()
+		var right Expr = p.bitOr()
+		expr = newBinary(expr, operator, right)
+	}
+	return expr
+}
+
+// bitOr → bitXor ( "|" bitXor )* ;
+func (p *Parser) bitOr() Expr {
+	var expr Expr = p.bitXor()
+	for p.match(PIPE) {
+		var operator Token = p.previous()
+		var right Expr = p.bitXor()
+		expr = newBinary(expr, operator, right)
+	}
+	return expr
+}
+
+// bitXor → bitAnd ( "^" bitAnd )* ;
+func (p *Parser) bitXor() Expr {
+	var expr Expr = p.bitAnd()
+	for p.match(CARET) {
+		var operator Token = p.previous()
+		var right Expr = p.bitAnd()
+		expr = newBinary(expr, operator, right)
+	}
+	return expr
+}
+
+// bitAnd → shift ( "&" shift )* ;
+func (p *Parser) bitAnd() Expr {
+	var expr Expr = p.shift()
+	for p.match(AMPERSAND) {
+		var operator Token = p.previous()
+		var right Expr = p.shift()
+		expr = newBinary(expr, operator, right)
+	}
+	return expr
+}
+
+// shift → term ( ( "<<" | ">>" ) term )* ;
+func (p *Parser) shift() Expr {
+	var expr Expr = p.term()
+	for p.match(LESS_LESS, GREATER_GREATER) {
 		var operator Token = p.previous()
 		var right Expr = p.term()
 		expr = newBinary(expr, operator, right)
@@ -156,10 +212,10 @@ func (p *Parser) term() Expr {
 	return expr
 }
 
-// factor → unary ( ( "/" | "*" ) unary )* ;
+// factor → unary ( ( "/" | "*" | "%" ) unary )* ;
 func (p *Parser) factor() Expr {
 	var expr Expr = p.unary()
-	for p.match(SLASH, STAR) {
+	for p.match(SLASH, STAR, PERCENT) {
 		var operator Token = p.previous()
 		var right Expr = p.unary()
 		expr = newBinary(expr, operator, right)
@@ -167,9 +223,9 @@ func (p *Parser) factor() Expr {
 	return expr
 }
 
-// unary → ( "!" | "-" ) unary | primary
+// unary → ( "!" | "-" | "~" ) unary | primary
 func (p *Parser) unary() Expr {
-	if p.match(BANG, MINUS) {
+	if p.match(BANG, MINUS, TILDE) {
 		var operator = p.previous()
 		var right = p.unary()
 		return newUnary(operator, right)
@@ -191,29 +247,47 @@ func (p *Parser) primary() Expr {
 	if p.match(NUMBER, STRING) {
 		return newLiteral(p.previous().literal)
 	}
+	if p.match(INTERPOLATION) {
+		return p.interpolation()
+	}
 	if p.match(SUPER) {
 		var keyword Token = p.previous()
 		p.consume(DOT, "Expect '.' after 'super'.")
 		var method Token = p.consume(IDENTIFIER, "Expect superclass method name.")
-		return newSuper(keyword, method)
+		return newSuper(keyword, method, nil)
 	}
 	if p.match(THIS) {
-		return newThis(p.previous())
+		return newThis(p.previous(), nil)
 	}
 	if p.match(IDENTIFIER) {
-		return newVariable(p.previous())
+		return newVariable(p.previous(), nil)
 	}
 	if p.match(LEFT_PAREN) {
 		var expr Expr = p.expression()
 		p.consume(RIGHT_PAREN, "Expect ')' after expression.")
 		return newGrouping(expr)
 	}
-	if p.match(EOF) {
-		return nil
-	}
 
+	// The error stops the script from running, but the tree is still
+	// resolved, so it gets a placeholder rather than a nil expression.
 	TokenError(p.peek(), "Expect expression.")
-	return nil
+	return newLiteral(nil)
+}
+
+// interpolation → ( INTERPOLATION expression )+ STRING ;
+func (p *Parser) interpolation() Expr {
+	var start Token = p.previous()
+	var parts = []Expr{newLiteral(start.literal)}
+	for {
+		parts = append(parts, p.expression())
+		if p.match(INTERPOLATION) {
+			parts = append(parts, newLiteral(p.previous().literal))
+			continue
+		}
+		var end Token = p.consume(STRING, "Expect '}' after interpolated expression.")
+		parts = append(parts, newLiteral(end.literal))
+		return newInterpolation(start, parts)
+	}
 }
 
 func (p *Parser) call() Expr {
@@ -223,7 +297,11 @@ func (p *Parser) call() Expr {
 			expr = p.finishCall(expr)
 		} else if p.match(DOT) {
 			var name Token = p.consume(IDENTIFIER, "Expect property name after '.'.")
-			expr = newGet(expr, name)
+			expr = newGet(expr, name, nil)
+		} else if p.match(LEFT_BRACKET) {
+			var index Expr = p.expression()
+			var bracket Token = p.consume(RIGHT_BRACKET, "Expect ']' after index.")
+			expr = newIndex(expr, bracket, index)
 		} else {
 			break
 		}
@@ -275,16 +353,30 @@ func (p *Parser) parse() []Stmt {
 	return statements
 }
 
-func (p *Parser) declaration() Stmt {
+// recordLine remembers the line a statement starts on once it is parsed.
+func (p *Parser) recordLine(line int, stmt *Stmt) {
+	if *stmt != nil {
+		p.lines[*stmt] = line
+	}
+}
+
+func (p *Parser) declaration() (stmt Stmt) {
+	defer p.recordLine(p.peek().line, &stmt)
 	if p.match(CLASS) {
 		return p.classDeclaration()
 	}
+	if p.match(TRAIT) {
+		return p.traitDeclaration()
+	}
 	if p.match(FUN) {
 		return p.function("function")
 	}
 	if p.match(VAR) {
 		return p.varDeclaration()
 	}
+	if p.match(IMPORT) {
+		return p.importDeclaration()
+	}
 	return p.statement()
 	// parser.synchronize()
 }
@@ -296,7 +388,17 @@ func (p *Parser) classDeclaration() Stmt {
 	// if (match(LESS)) {
 	if p.match(LESS) {
 		p.consume(IDENTIFIER, "Expect superclass name.")
-		superclass = newVariable(p.previous())
+		superclass = newVariable(p.previous(), nil)
+	}
+	var traits []*Variable = []*Variable{}
+	if p.match(WITH) {
+		for {
+			p.consume(IDENTIFIER, "Expect trait name.")
+			traits = append(traits, newVariable(p.previous(), nil))
+			if !p.match(COMMA) {
+				break
+			}
+		}
 	}
 	p.consume(LEFT_BRACE, "Expect '{' before class body.")
 	var methods []*Function = []*Function{}
@@ -305,7 +407,18 @@ func (p *Parser) classDeclaration() Stmt {
 
 	}
 	p.consume(RIGHT_BRACE, "Expect '}' after class body.")
-	return newClass(name, superclass, methods)
+	return newClass(name, superclass, traits, methods)
+}
+
+func (p *Parser) traitDeclaration() Stmt {
+	var name Token = p.consume(IDENTIFIER, "Expect trait name.")
+	p.consume(LEFT_BRACE, "Expect '{' before trait body.")
+	var methods []*Function = []*Function{}
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, p.function("method"))
+	}
+	p.consume(RIGHT_BRACE, "Expect '}' after trait body.")
+	return newTrait(name, methods)
 }
 
 func (p *Parser) varDeclaration() Stmt {
@@ -318,8 +431,22 @@ func (p *Parser) varDeclaration() Stmt {
 	return newVa(name, initializer)
 }
 
+func (p *Parser) importDeclaration() Stmt {
+	var keyword Token = p.previous()
+	var path Token = p.consume(STRING, "Expect module path after 'import'.")
+	p.consume(AS, "Expect 'as' after module path.")
+	var name Token = p.consume(IDENTIFIER, "Expect module name after 'as'.")
+	p.consume(SEMICOLON, "Expect ';' after import.")
+	return newImport(keyword, path, name)
+}
+
 func (p *Parser) function(kind string) *Function {
 	var name Token = p.consume(IDENTIFIER, "Expected "+kind+" name.")
+	// A method without a parameter list is a getter.
+	if kind == "method" && p.check(LEFT_BRACE) {
+		p.consume(LEFT_BRACE, "Expect '{' before getter body.")
+		return newFunction(name, []Token{}, p.block(), true)
+	}
 	p.consume(LEFT_PAREN, "Expect '(' after "+kind+" name.")
 	var parameters []Token = []Token{}
 	if !p.check(RIGHT_PAREN) {
@@ -334,10 +461,11 @@ func (p *Parser) function(kind string) *Function {
 	p.consume(RIGHT_PAREN, "Expect ')' after parameters.")
 	p.consume(LEFT_BRACE, "Expect '{' before "+kind+" body.")
 	var body []Stmt = p.block()
-	return newFunction(name, parameters, body)
+	return newFunction(name, parameters, body, false)
 }
 
-func (p *Parser) statement() Stmt {
+func (p *Parser) statement() (stmt Stmt) {
+	defer p.recordLine(p.peek().line, &stmt)
 	if p.match(FOR) {
 		return p.forStatement()
 	}
@@ -350,6 +478,12 @@ func (p *Parser) statement() Stmt {
 	if p.match(RETURN) {
 		return p.returnStatement()
 	}
+	if p.match(THROW) {
+		return p.throwStatement()
+	}
+	if p.match(TRY) {
+		return p.tryStatement()
+	}
 	if p.match(WHILE) {
 		return p.whileStatement()
 	}
@@ -372,7 +506,39 @@ func (p *Parser) returnStatement() Stmt {
 		value = p.expression()
 	}
 	p.consume(SEMICOLON, "Expect ';' after return value")
-	return newReturn(keyword, value)
+	return newReturn(keyword, value, false)
+}
+
+func (p *Parser) throwStatement() Stmt {
+	var keyword Token = p.previous()
+	var value Expr = p.expression()
+	p.consume(SEMICOLON, "Expect ';' after thrown value.")
+	return newThrow(keyword, value)
+}
+
+func (p *Parser) tryStatement() Stmt {
+	var keyword Token = p.previous()
+	p.consume(LEFT_BRACE, "Expect '{' after 'try'.")
+	var body []Stmt = p.block()
+	var catchName *Token = nil
+	var catchBody []Stmt = nil
+	var finallyBody []Stmt = nil
+	if p.match(CATCH) {
+		p.consume(LEFT_PAREN, "Expect '(' after 'catch'.")
+		var name Token = p.consume(IDENTIFIER, "Expect exception variable name.")
+		catchName = &name
+		p.consume(RIGHT_PAREN, "Expect ')' after exception variable.")
+		p.consume(LEFT_BRACE, "Expect '{' before catch body.")
+		catchBody = p.block()
+	}
+	if p.match(FINALLY) {
+		p.consume(LEFT_BRACE, "Expect '{' after 'finally'.")
+		finallyBody = p.block()
+	}
+	if catchBody == nil && finallyBody == nil {
+		p.error(p.peek(), "Expect 'catch' or 'finally' after try block.")
+	}
+	return newTry(keyword, body, catchName, catchBody, finallyBody)
 }
 
 func (p *Parser) whileStatement() Stmt {
@@ -390,6 +556,7 @@ func (p *Parser) expressionStatement() Stmt {
 }
 
 func (p *Parser) forStatement() Stmt {
+	var keyword Token = p.previous()
 	p.consume(LEFT_PAREN, "Expect '(' after 'for'.")
 	var initializer Stmt
 	if p.match(SEMICOLON) {
@@ -406,6 +573,7 @@ func (p *Parser) forStatement() Stmt {
 	p.consume(SEMICOLON, "Expect ';' after loop condition.")
 
 	var increment Expr = nil
+	var incrementLine = p.peek().line
 	if !p.check(RIGHT_PAREN) {
 		increment = p.expression()
 	}
@@ -413,13 +581,17 @@ func (p *Parser) forStatement() Stmt {
 	var body = p.statement()
 
 	if increment != nil {
-		body = newBlock([]Stmt{body, newExpression(increment)})
+		var step = newExpression(increment)
+		p.lines[step] = incrementLine
+		body = newBlock([]Stmt{body, step})
+		p.lines[body] = keyword.line
 	}
 
 	if condition == nil {
 		condition = newLiteral(true)
 	}
 	body = newWhile(condition, body)
+	p.lines[body] = keyword.line
 
 	if initializer != nil {
 		body = newBlock([]Stmt{initializer, body})
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const profilePeriod = 10 * time.Millisecond
+
+// profileFunction identifies a Lox function in a profile. Top-level code
+// shows up as "script" in the file it belongs to.
+type profileFunction struct {
+	name      string
+	file      string
+	startLine int
+}
+
+type profileLocation struct {
+	function profileFunction
+	line     int
+}
+
+type profileSample struct {
+	locations []uint64
+	count     int64
+}
+
+// Profiler samples the Lox call stack. A timer counts the samples that are
+// due, and they are taken before the next statement runs, so time spent in
+// natives is charged to the statement that follows.
+type Profiler struct {
+	pending   atomic.Int64
+	ticker    *time.Ticker
+	stopped   chan struct{}
+	started   time.Time
+	duration  time.Duration
+	modules   []*LoxModule
+	lines     []int
+	functions map[profileFunction]uint64
+	locations map[profileLocation]uint64
+	samples   map[string]*profileSample
+	order     []string
+}
+
+func newProfiler() *Profiler {
+	return &Profiler{
+		functions: map[profileFunction]uint64{},
+		locations: map[profileLocation]uint64{},
+		samples:   map[string]*profileSample{},
+	}
+}
+
+func (p *Profiler) start() {
+	p.started = time.Now()
+	p.ticker = time.NewTicker(profilePeriod)
+	p.stopped = make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-p.ticker.C:
+				p.pending.Add(1)
+			case <-p.stopped:
+				return
+			}
+		}
+	}()
+}
+
+func (p *Profiler) stop() {
+	p.ticker.Stop()
+	close(p.stopped)
+	p.duration = time.Since(p.started)
+}
+
+func (p *Profiler) loaded(i *Interpreter, path string, statements []Stmt) {}
+
+func (p *Profiler) beforeStatement(i *Interpreter, stmt Stmt) {
+	line, ok := i.lines[stmt]
+	if !ok {
+		return
+	}
+	var depth = len(i.frames)
+	for len(p.lines) <= depth {
+		p.lines = append(p.lines, 0)
+		p.modules = append(p.modules, nil)
+	}
+	p.lines[depth], p.modules[depth] = line, i.module
+	var count = p.pending.Swap(0)
+	if count > 0 {
+		p.sample(i, depth, count)
+	}
+}
+
+func (p *Profiler) enterFunction(i *Interpreter, function LoxCallable, arguments []any) {}
+
+func (p *Profiler) exitFunction(i *Interpreter, function LoxCallable, value any) {}
+
+func (p *Profiler) branchTaken(i *Interpreter, node any, branch int) {}
+
+func (p *Profiler) assigned(i *Interpreter, name Token, value any) {}
+
+// sample records the stack, innermost frame first. The line of an outer
+// frame is the statement that made the call.
+func (p *Profiler) sample(i *Interpreter, depth int, count int64) {
+	var locations = []uint64{}
+	var key = ""
+	for d := depth; d >= 0; d-- {
+		var location = p.location(i, d)
+		id, ok := p.locations[location]
+		if !ok {
+			id = uint64(len(p.locations) + 1)
+			p.locations[location] = id
+		}
+		if _, ok := p.functions[location.function]; !ok {
+			p.functions[location.function] = uint64(len(p.functions) + 1)
+		}
+		locations = append(locations, id)
+		key += fmt.Sprint(id, ",")
+	}
+	sample, ok := p.samples[key]
+	if !ok {
+		sample = &profileSample{locations: locations}
+		p.samples[key] = sample
+		p.order = append(p.order, key)
+	}
+	sample.count += count
+}
+
+// location describes frame d of the stack. Natives run no statements, so
+// their frames have no file or line.
+func (p *Profiler) location(i *Interpreter, d int) profileLocation {
+	if d == 0 {
+		return profileLocation{profileFunction{"script", absolutePath(p.modules[d].path), 1}, p.lines[d]}
+	}
+	switch callee := i.frames[d-1].callee.(type) {
+	case *LoxFunction:
+		var declaration = callee.declaration
+		return profileLocation{profileFunction{declaration.name.lexeme, absolutePath(callee.module.path), declaration.name.line}, p.lines[d]}
+	case *LoxClass:
+		var function = profileFunction{callee.name, "", 0}
+		if initializer := callee.findMethod("init"); initializer != nil {
+			function.file, function.startLine = absolutePath(initializer.module.path), initializer.declaration.name.line
+		}
+		return profileLocation{function, p.lines[d]}
+	default:
+		return profileLocation{profileFunction{fmt.Sprint(callee), "", 0}, 0}
+	}
+}
+
+// write encodes the profile in the gzipped protocol buffer format read by
+// go tool pprof.
+func (p *Profiler) write(out io.Writer) error {
+	var table = []string{""}
+	var indexes = map[string]int{"": 0}
+	var index = func(s string) uint64 {
+		if _, ok := indexes[s]; !ok {
+			indexes[s] = len(table)
+			table = append(table, s)
+		}
+		return uint64(indexes[s])
+	}
+	var valueType = func(kind string, unit string) func(b *protoBuffer) {
+		return func(b *protoBuffer) {
+			b.uint64Field(1, index(kind))
+			b.uint64Field(2, index(unit))
+		}
+	}
+
+	var profile = &protoBuffer{}
+	profile.message(1, valueType("samples", "count"))
+	profile.message(1, valueType("cpu", "nanoseconds"))
+	for _, key := range p.order {
+		var sample = p.samples[key]
+		profile.message(2, func(b *protoBuffer) {
+			b.packed(1, sample.locations)
+			b.packed(2, []uint64{uint64(sample.count), uint64(sample.count * int64(profilePeriod))})
+		})
+	}
+	for location, id := range p.locations {
+		profile.message(4, func(b *protoBuffer) {
+			b.uint64Field(1, id)
+			b.message(4, func(b *protoBuffer) {
+				b.uint64Field(1, p.functions[location.function])
+				b.uint64Field(2, uint64(location.line))
+			})
+		})
+	}
+	for function, id := range p.functions {
+		profile.message(5, func(b *protoBuffer) {
+			b.uint64Field(1, id)
+			b.uint64Field(2, index(function.name))
+			b.uint64Field(3, index(function.name))
+			b.uint64Field(4, index(function.file))
+			b.uint64Field(5, uint64(function.startLine))
+		})
+	}
+	profile.uint64Field(9, uint64(p.started.UnixNano()))
+	profile.uint64Field(10, uint64(p.duration))
+	profile.message(11, valueType("cpu", "nanoseconds"))
+	profile.uint64Field(12, uint64(profilePeriod))
+	// The string table goes last, once every string has been indexed.
+	for _, s := range table {
+		profile.stringField(6, s)
+	}
+
+	var zipped = gzip.NewWriter(out)
+	if _, err := zipped.Write(profile.data); err != nil {
+		return err
+	}
+	return zipped.Close()
+}
+
+// protoBuffer encodes protocol buffer messages. Zero numbers are left out,
+// as they are the default.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) uint64Field(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+func (b *protoBuffer) bytesField(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) stringField(field int, s string) {
+	b.bytesField(field, []byte(s))
+}
+
+func (b *protoBuffer) packed(field int, values []uint64) {
+	var inner = &protoBuffer{}
+	for _, value := range values {
+		inner.varint(value)
+	}
+	b.bytesField(field, inner.data)
+}
+
+func (b *protoBuffer) message(field int, encode func(b *protoBuffer)) {
+	var inner = &protoBuffer{}
+	encode(inner)
+	b.bytesField(field, inner.data)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// everyStatement samples a Profiler before every statement instead of on
+// a timer, so that sample counts are exact.
+type everyStatement struct {
+	*Profiler
+}
+
+func (e everyStatement) beforeStatement(i *Interpreter, stmt Stmt) {
+	e.pending.Store(1)
+	e.Profiler.beforeStatement(i, stmt)
+}
+
+// protoField is a decoded protocol buffer field: a varint or bytes.
+type protoField struct {
+	number int
+	varint uint64
+	bytes  []byte
+}
+
+func decodeProto(t *testing.T, data []byte) []protoField {
+	t.Helper()
+	var fields = []protoField{}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		var field = protoField{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			field.varint, n = binary.Uvarint(data)
+			data = data[n:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			data = data[n:]
+			field.bytes, data = data[:length], data[length:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func decodePacked(data []byte) []uint64 {
+	var values = []uint64{}
+	for len(data) > 0 {
+		value, n := binary.Uvarint(data)
+		values = append(values, value)
+		data = data[n:]
+	}
+	return values
+}
+
+// fieldMap gives the last varint and bytes of each field of a message.
+func fieldMap(t *testing.T, data []byte) (map[int]uint64, map[int][]byte) {
+	var varints, bytes = map[int]uint64{}, map[int][]byte{}
+	for _, field := range decodeProto(t, data) {
+		varints[field.number], bytes[field.number] = field.varint, field.bytes
+	}
+	return varints, bytes
+}
+
+const profileProgram = `fun square(x) {
+  return x * x;
+}
+var total = 0;
+for (var i = 0; i < 3; i = i + 1) {
+  total = total + square(i);
+}
+print total;
+`
+
+func TestProfile(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "main.lox")
+	if err := os.WriteFile(path, []byte(profileProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var profiler = newProfiler()
+	profiler.started = time.Now()
+	var stdout, stderr = runCapturedAt(profileProgram, path, "", withHook(everyStatement{profiler}))
+	if stdout != "5\n" || stderr != "" {
+		t.Fatalf("got stdout %q and stderr %q", stdout, stderr)
+	}
+	var zipped bytes.Buffer
+	if err := profiler.write(&zipped); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(&zipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields = decodeProto(t, data)
+	var table = []string{}
+	for _, field := range fields {
+		if field.number == 6 {
+			table = append(table, string(field.bytes))
+		}
+	}
+	if len(table) == 0 || table[0] != "" {
+		t.Fatalf("got string table %q", table)
+	}
+	type function struct {
+		name, systemName, file string
+		startLine              uint64
+	}
+	type location struct {
+		function uint64
+		line     uint64
+	}
+	var functions = map[uint64]function{}
+	var locations = map[uint64]location{}
+	type sample struct {
+		locations, values []uint64
+	}
+	var samples = []sample{}
+	var sampleTypes = []string{}
+	var period uint64
+	for _, field := range fields {
+		switch field.number {
+		case 1:
+			var varints, _ = fieldMap(t, field.bytes)
+			sampleTypes = append(sampleTypes, table[varints[1]]+"/"+table[varints[2]])
+		case 2:
+			var _, bytes = fieldMap(t, field.bytes)
+			samples = append(samples, sample{decodePacked(bytes[1]), decodePacked(bytes[2])})
+		case 4:
+			var varints, bytes = fieldMap(t, field.bytes)
+			var line, _ = fieldMap(t, bytes[4])
+			locations[varints[1]] = location{line[1], line[2]}
+		case 5:
+			var varints, _ = fieldMap(t, field.bytes)
+			functions[varints[1]] = function{table[varints[2]], table[varints[3]], table[varints[4]], varints[5]}
+		case 12:
+			period = field.varint
+		}
+	}
+	if len(sampleTypes) != 2 || sampleTypes[0] != "samples/count" || sampleTypes[1] != "cpu/nanoseconds" {
+		t.Errorf("got sample types %v", sampleTypes)
+	}
+	if period != uint64(profilePeriod) {
+		t.Errorf("got period %d", period)
+	}
+
+	// Resolve every sample to a readable stack, innermost frame first.
+	var stacks = map[string][]uint64{}
+	for _, sample := range samples {
+		var stack = ""
+		for _, id := range sample.locations {
+			var location = locations[id]
+			var function = functions[location.function]
+			if function.file != absolutePath(path) || function.name != function.systemName {
+				t.Errorf("got function %+v", function)
+			}
+			stack += fmt.Sprintf("%s:%d ", function.name, location.line)
+		}
+		stacks[stack] = sample.values
+	}
+	var want = map[string]uint64{
+		"square:2 script:6 ": 3,
+		"script:6 ":          3,
+		"script:8 ":          1,
+	}
+	for stack, count := range want {
+		var values = stacks[stack]
+		if len(values) != 2 || values[0] != count || values[1] != count*uint64(profilePeriod) {
+			t.Errorf("stack %q has values %v, want %d samples; stacks are %v", stack, values, count, stacks)
+		}
+	}
+	for _, function := range functions {
+		var startLine = map[string]uint64{"square": 1, "script": 1}[function.name]
+		if function.startLine != startLine {
+			t.Errorf("function %s starts at %d, want %d", function.name, function.startLine, startLine)
+		}
+	}
+}
@@ -15,21 +15,36 @@ const (
 	NO_CLASS classType = iota
 	YES_CLASS
 	SUB_CLASS
+	TRAIT_CLASS
 )
 
+// Local is where a resolved local variable lives: the number of
+// environments between its use and its declaration, and its slot there.
+type Local struct {
+	depth int
+	slot  int
+}
+
+// scope maps the names declared in a block to their slots, in declaration
+// order. defined is false while a variable's initializer is resolved.
+type scope struct {
+	slots   map[string]int
+	defined map[string]bool
+}
+
 type Resolver struct {
-	interpreter     *Interpreter
-	scopes          []any
+	scopes          []*scope
 	currentFunction functionType
 	currentClass    classType
+	tryDepth        int
 }
 
-func newResolver(interpreter *Interpreter) Resolver {
-	return Resolver{interpreter: interpreter, currentFunction: NONE, currentClass: NO_CLASS}
+func newResolver() Resolver {
+	return Resolver{currentFunction: NONE, currentClass: NO_CLASS}
 }
 
 func (r *Resolver) beginScope() {
-	r.scopes = append(r.scopes, map[string]bool{})
+	r.scopes = append(r.scopes, &scope{slots: map[string]int{}, defined: map[string]bool{}})
 }
 
 func (r *Resolver) resolve(statements any) any {
@@ -48,13 +63,16 @@ func (r *Resolver) resolve(statements any) any {
 	return nil
 }
 
-func (r *Resolver) resolveLocal(expr Expr, name Token) {
+// resolveLocal finds the innermost declaration of name. It returns nil for
+// globals, which are looked up by name at runtime.
+func (r *Resolver) resolveLocal(name Token) *Local {
 	for i := len(r.scopes) - 1; i >= 0; i-- {
-		_, ok := r.scopes[i].(map[string]bool)[name.lexeme]
+		slot, ok := r.scopes[i].slots[name.lexeme]
 		if ok {
-			r.interpreter.resolve(expr, len(r.scopes)-1-i)
+			return &Local{depth: len(r.scopes) - 1 - i, slot: slot}
 		}
 	}
+	return nil
 }
 
 func (r *Resolver) endScope() {
@@ -66,13 +84,15 @@ func (r *Resolver) declare(name Token) {
 	if len(r.scopes) == 0 {
 		return
 	}
-	var scope = r.scopes[len(r.scopes)-1].(map[string]bool)
+	var scope = r.scopes[len(r.scopes)-1]
 	// 	if (scope.containsKey(name.lexeme)) {
-	_, ok := scope[name.lexeme]
+	_, ok := scope.slots[name.lexeme]
 	if ok {
 		TokenError(name, "Already variable with this name in this scope.")
+		return
 	}
-	scope[name.lexeme] = false
+	scope.slots[name.lexeme] = len(scope.slots)
+	scope.defined[name.lexeme] = false
 	return
 }
 
@@ -80,13 +100,25 @@ func (r *Resolver) define(name Token) {
 	if len(r.scopes) == 0 {
 		return
 	}
-	r.scopes[len(r.scopes)-1].(map[string]bool)[name.lexeme] = true
+	r.scopes[len(r.scopes)-1].defined[name.lexeme] = true
+}
+
+// bind declares and defines a variable the interpreter creates itself, such
+// as "this" and "super".
+func (r *Resolver) bind(name string) {
+	r.declare(Token{tokenType: IDENTIFIER, lexeme: name})
+	r.define(Token{tokenType: IDENTIFIER, lexeme: name})
 }
 
 func (r *Resolver) resolveFunction(function *Function, ftype functionType) {
 	var enclosingFunction = r.currentFunction
+	var enclosingTryDepth = r.tryDepth
 	r.currentFunction = ftype
+	r.tryDepth = 0
 	r.beginScope()
+	if ftype == METHOD || ftype == INITIALIZER {
+		r.bind("this")
+	}
 	for _, param := range function.params {
 		r.declare(param)
 		r.define(param)
@@ -94,6 +126,7 @@ func (r *Resolver) resolveFunction(function *Function, ftype functionType) {
 	r.resolve(function.body)
 	r.endScope()
 	r.currentFunction = enclosingFunction
+	r.tryDepth = enclosingTryDepth
 }
 func (r *Resolver) visitClassStmt(stmt *Class) any {
 	var enclosingClass = r.currentClass
@@ -107,20 +140,26 @@ func (r *Resolver) visitClassStmt(stmt *Class) any {
 		r.currentClass = SUB_CLASS
 		r.resolve(stmt.superclass)
 	}
+	for _, trait := range stmt.traits {
+		if stmt.name.lexeme == trait.name.lexeme {
+			TokenError(trait.name, "A class can't use itself as a trait.")
+		}
+		r.resolve(trait)
+	}
 	if stmt.superclass != nil {
 		r.beginScope()
-		r.scopes[len(r.scopes)-1].(map[string]bool)["super"] = true
+		r.bind("super")
 	}
-	r.beginScope()
-	r.scopes[len(r.scopes)-1].(map[string]bool)["this"] = true
 	for _, method := range stmt.methods {
 		var declaration = METHOD
 		if method.name.lexeme == "init" {
 			declaration = INITIALIZER
+			if method.isGetter {
+				TokenError(method.name, "An initializer can't be a getter.")
+			}
 		}
 		r.resolveFunction(method, declaration)
 	}
-	r.endScope()
 	if stmt.superclass != nil {
 		r.endScope()
 	}
@@ -128,6 +167,27 @@ func (r *Resolver) visitClassStmt(stmt *Class) any {
 	return nil
 }
 
+func (r *Resolver) visitTraitStmt(stmt *Trait) any {
+	var enclosingClass = r.currentClass
+	r.currentClass = TRAIT_CLASS
+	r.declare(stmt.name)
+	r.define(stmt.name)
+	// Trait methods get the same scope layout as subclass methods, so
+	// "super" resolves to the superclass of whichever class uses the trait.
+	r.beginScope()
+	r.bind("super")
+	for _, method := range stmt.methods {
+		var declaration = METHOD
+		if method.name.lexeme == "init" {
+			declaration = INITIALIZER
+		}
+		r.resolveFunction(method, declaration)
+	}
+	r.endScope()
+	r.currentClass = enclosingClass
+	return nil
+}
+
 func (r *Resolver) visitBlockStmt(stmt *Block) any {
 	r.beginScope()
 	r.resolve(stmt.statements)
@@ -146,19 +206,19 @@ func (r *Resolver) visitVaStmt(stmt *Va) any {
 
 func (r *Resolver) visitVariableExpr(expr *Variable) any {
 	if len(r.scopes) != 0 {
-		scope := r.scopes[len(r.scopes)-1].(map[string]bool)
-		val, ok := scope[expr.name.lexeme]
+		scope := r.scopes[len(r.scopes)-1]
+		val, ok := scope.defined[expr.name.lexeme]
 		if ok && val == false {
 			TokenError(expr.name, "Can't read local variable in its own initializer.")
 		}
 	}
-	r.resolveLocal(expr, expr.name)
+	expr.local = r.resolveLocal(expr.name)
 	return nil
 }
 
 func (r *Resolver) visitAssignExpr(expr *Assign) any {
 	r.resolve(expr.value)
-	r.resolveLocal(expr, expr.name)
+	expr.local = r.resolveLocal(expr.name)
 	return nil
 }
 func (r *Resolver) visitExpressionStmt(stmt *Expression) any {
@@ -181,6 +241,12 @@ func (r *Resolver) visitIfStmt(stmt *If) any {
 	}
 	return nil
 }
+func (r *Resolver) visitImportStmt(stmt *Import) any {
+	r.declare(stmt.name)
+	r.define(stmt.name)
+	return nil
+}
+
 func (r *Resolver) visitPrintStmt(stmt *Print) any {
 	r.resolve(stmt.expression)
 	return nil
@@ -193,8 +259,38 @@ func (r *Resolver) visitReturnStmt(stmt *Return) any {
 		}
 		r.resolve(stmt.value)
 	}
+	// A call returned directly from a function reuses the caller's frame,
+	// unless a try statement still has to handle what the call does.
+	_, isCall := stmt.value.(*Call)
+	stmt.tail = isCall && r.currentFunction != NONE && r.tryDepth == 0
+	return nil
+}
+func (r *Resolver) visitThrowStmt(stmt *Throw) any {
+	r.resolve(stmt.value)
+	return nil
+}
+
+func (r *Resolver) visitTryStmt(stmt *Try) any {
+	r.tryDepth++
+	defer func() { r.tryDepth-- }()
+	r.beginScope()
+	r.resolve(stmt.body)
+	r.endScope()
+	if stmt.catchName != nil {
+		r.beginScope()
+		r.declare(*stmt.catchName)
+		r.define(*stmt.catchName)
+		r.resolve(stmt.catchBody)
+		r.endScope()
+	}
+	if stmt.finallyBody != nil {
+		r.beginScope()
+		r.resolve(stmt.finallyBody)
+		r.endScope()
+	}
 	return nil
 }
+
 func (r *Resolver) visitWhileStmt(stmt *While) any {
 	r.resolve(stmt.condition)
 	r.resolve(stmt.body)
@@ -231,7 +327,7 @@ func (r *Resolver) visitThisExpr(expr *This) any {
 		TokenError(expr.keyword, "Can't use 'this' outside of a class.")
 		return nil
 	}
-	r.resolveLocal(expr, expr.keyword)
+	expr.local = r.resolveLocal(expr.keyword)
 	return nil
 }
 
@@ -240,6 +336,19 @@ func (r *Resolver) visitGroupingExpr(expr *Grouping) any {
 	return nil
 }
 
+func (r *Resolver) visitIndexExpr(expr *Index) any {
+	r.resolve(expr.object)
+	r.resolve(expr.index)
+	return nil
+}
+
+func (r *Resolver) visitInterpolationExpr(expr *Interpolation) any {
+	for _, part := range expr.parts {
+		r.resolve(part)
+	}
+	return nil
+}
+
 func (r *Resolver) visitLiteralExpr(expr *Literal) any {
 	return nil
 }
@@ -258,9 +367,9 @@ func (r *Resolver) visitUnaryExpr(expr *Unary) any {
 func (r *Resolver) visitSuperExpr(expr *Super) any {
 	if r.currentClass == NO_CLASS {
 		TokenError(expr.keyword, "Can't use 'super' outside of a class.")
-	} else if r.currentClass != SUB_CLASS {
+	} else if r.currentClass != SUB_CLASS && r.currentClass != TRAIT_CLASS {
 		TokenError(expr.keyword, "Can't use 'super' in a class with no superclass.")
 	}
-	r.resolveLocal(expr, expr.keyword)
+	expr.local = r.resolveLocal(expr.keyword)
 	return nil
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestResolverScopes(t *testing.T) {
+	var tests = []struct {
+		name   string
+		source string
+		stdout string
+	}{
+		{"shadowed locals", `
+var a = "global";
+{
+  var a = "outer";
+  {
+    var a = "inner";
+    fun show() { print a; }
+    show();
+  }
+  print a;
+}
+print a;
+`, "inner\nouter\nglobal\n"},
+		{"closure resolved before shadowing", `
+var a = "global";
+{
+  fun show() { print a; }
+  show();
+  var a = "block";
+  show();
+  print a;
+}
+`, "global\nglobal\nblock\n"},
+		{"closure over shadowed parameter", `
+fun outer(x) {
+  fun middle() {
+    var x = "middle";
+    fun inner() { return x; }
+    return inner;
+  }
+  return middle();
+}
+print outer("param")();
+`, "middle\n"},
+		{"closures over block variables", `
+fun makeCounter() {
+  var count = 0;
+  fun increment() {
+    count = count + 1;
+    return count;
+  }
+  return increment;
+}
+var first = makeCounter();
+var second = makeCounter();
+print first();
+print first();
+print second();
+`, "1\n2\n1\n"},
+		{"closures over loop variables", `
+var firstBody; var secondBody; var firstLoop; var secondLoop;
+for (var i = 0; i < 2; i = i + 1) {
+  var j = i;
+  fun body() { return j; }
+  fun loop() { return i; }
+  if (i == 0) { firstBody = body; firstLoop = loop; }
+  else { secondBody = body; secondLoop = loop; }
+}
+print firstBody();
+print secondBody();
+print firstLoop();
+print secondLoop();
+`, "0\n1\n2\n2\n"},
+		{"slot order after redeclaration", `
+{
+  var a = "a";
+  {
+    var a = "shadow";
+    var b = "inner b";
+    print a + " " + b;
+  }
+  var b = "b";
+  class C {}
+  fun f() { return "f"; }
+  var c = "c";
+  print a + " " + b + " " + c + " " + f();
+  print C;
+}
+var g = 1;
+var g = 2;
+print g;
+`, "shadow inner b\na b c f\nC\n2\n"},
+		{"catch variable", `
+{
+  var before = "before";
+  try { throw "thrown"; } catch (e) { var inside = "inside"; print e + " " + inside; }
+  var after = "after";
+  print before + " " + after;
+}
+`, "thrown inside\nbefore after\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr = runCaptured(test.source, "")
+			if stdout != test.stdout || stderr != "" {
+				t.Errorf("got stdout %q and stderr %q, want stdout %q", stdout, stderr, test.stdout)
+			}
+		})
+	}
+}
+
+func TestResolverRedeclaration(t *testing.T) {
+	var stdout, stderr = runCaptured(`{ var a = 1; var a = 2; print a; }`, "")
+	if stdout != "" || stderr != "error report in line  1 in  at 'a' with message  Already variable with this name in this scope.\n" {
+		t.Errorf("got stdout %q and stderr %q", stdout, stderr)
+	}
+}
+
+// TestResolverSlots checks the (depth, slot) pairs given to variables.
+func TestResolverSlots(t *testing.T) {
+	var source = `
+{
+  var a = 1;
+  var b = 2;
+  {
+    var a = 3;
+    var c = 4;
+    print a + b + c;
+  }
+  var d = 5;
+  print a + d;
+}
+print nil;
+`
+	var statements = newParser(newScanner(source).scanTokens()).parse()
+	var resolver = newResolver()
+	resolver.resolve(statements)
+	var got = []string{}
+	walkStatements(statements, func(node any) {
+		if variable, ok := node.(*Variable); ok {
+			got = append(got, variable.name.lexeme+" "+describeLocal(variable.local))
+		}
+	})
+	var want = []string{"a 0:0", "b 1:1", "c 0:1", "a 0:0", "d 0:2"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for index := range want {
+		if got[index] != want[index] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func describeLocal(local *Local) string {
+	if local == nil {
+		return "global"
+	}
+	return fmt.Sprintf("%d:%d", local.depth, local.slot)
+}
+
+// The same loop is run on locals, which live in slots, and on globals,
+// which are still looked up by name in a map as every variable used to be.
+const variablesLoop = `
+  var count = 0;
+  var total = 0;
+  var i = 0;
+  while (i < 10000) {
+    var a = i;
+    {
+      var b = a + 1;
+      total = total + b - a;
+    }
+    count = count + 1;
+    i = i + 1;
+  }
+`
+
+func BenchmarkVariables(b *testing.B) {
+	var sources = []struct {
+		name   string
+		source string
+	}{
+		{"locals", "fun run() {" + variablesLoop + "}\nrun();"},
+		{"globals", variablesLoop},
+	}
+	for _, source := range sources {
+		b.Run(source.name, func(b *testing.B) {
+			var statements = newParser(newScanner(source.source).scanTokens()).parse()
+			var resolver = newResolver()
+			resolver.resolve(statements)
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				newInterpreter(withStdout(io.Discard)).interpret(statements)
+			}
+		})
+	}
+}
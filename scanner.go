@@ -1,7 +1,9 @@
 package main
 import (
-	"unicode"
+	"fmt"
 	"strconv"
+	"strings"
+	"unicode"
 )
 
 type Scanner struct {
@@ -10,6 +12,10 @@ type Scanner struct {
 	start   int
 	current int
 	line    int
+	// Index of the first character of the current line, for columns.
+	lineStart int
+	// Brace depth inside each "${" that is still open, innermost last.
+	interpolations []int
 }
 
 func newScanner(source string) *Scanner {
@@ -58,6 +64,17 @@ func (s *Scanner) addToken(token TokenType, literal ...any) {
 	s.tokens = append(s.tokens, *newToken(token, text, literal[0], s.line))
 }
 
+// newline is called after consuming a line break.
+func (s *Scanner) newline() {
+	s.line += 1
+	s.lineStart = s.current
+}
+
+// errorAt reports an error at the character with the given index.
+func (s *Scanner) errorAt(index int, message string) {
+	report(s.line, fmt.Sprintf(" column %d", index-s.lineStart+1), message)
+}
+
 func (s *Scanner) match(expected rune) bool {
 	if s.isAtEnd() {
 		return false
@@ -69,43 +86,171 @@ func (s *Scanner) match(expected rune) bool {
 	return true
 }
 
+// string scans the rest of a string literal. A "${" ends the current segment
+// with an INTERPOLATION token; the string resumes at the matching "}".
 func (s *Scanner) string() {
+	var value = []rune{}
 	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.line += 1
-			s.advance()
+		var c = s.advance()
+		if c == '\n' {
+			s.newline()
 		}
-		if s.isAtEnd() {
-			error(s.line, "unterminated string")
+		if c == '$' && s.peek() == '{' {
+			s.advance()
+			s.addToken(INTERPOLATION, string(value))
+			s.interpolations = append(s.interpolations, 0)
 			return
 		}
+		if c == '\\' {
+			escaped, ok := s.escape()
+			if !ok {
+				continue
+			}
+			c = escaped
+		}
+		value = append(value, c)
+	}
+	if s.isAtEnd() {
+		lineError(s.line, "unterminated string")
+		return
+	}
+	// closing
+	s.advance()
+	s.addToken(STRING, string(value))
+}
 
-		// closing
-		s.advance()
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'"':  '"',
+	'\\': '\\',
+	'$':  '$',
+}
 
+// escape scans the escape sequence after a backslash. It reports an error
+// and returns false for an invalid sequence.
+func (s *Scanner) escape() (rune, bool) {
+	if s.isAtEnd() {
+		return 0, false
+	}
+	var c = s.advance()
+	if c == 'u' {
+		return s.unicodeEscape()
+	}
+	escaped, ok := escapes[c]
+	if !ok {
+		lineError(s.line, "invalid escape sequence '\\"+string(c)+"'")
+		return 0, false
+	}
+	return escaped, true
+}
+
+// unicodeEscape scans the "{XXXX}" part of a \u{XXXX} escape, which holds
+// one to six hexadecimal digits.
+func (s *Scanner) unicodeEscape() (rune, bool) {
+	if !s.match('{') {
+		lineError(s.line, "expect '{' after '\\u'")
+		return 0, false
+	}
+	var digits = []rune{}
+	for s.peek() != '}' && s.peek() != '"' && !s.isAtEnd() {
+		digits = append(digits, s.advance())
+	}
+	if !s.match('}') {
+		lineError(s.line, "unterminated unicode escape")
+		return 0, false
+	}
+	var code, err = strconv.ParseUint(string(digits), 16, 32)
+	if err != nil || len(digits) == 0 || len(digits) > 6 {
+		lineError(s.line, "invalid unicode escape '\\u{"+string(digits)+"}'")
+		return 0, false
+	}
+	if code > unicode.MaxRune || (code >= 0xD800 && code <= 0xDFFF) {
+		lineError(s.line, "unicode escape '\\u{"+string(digits)+"}' is not a valid code point")
+		return 0, false
+	}
+	return rune(code), true
+}
+
+// rawString scans a backtick-delimited literal. Raw strings may span lines
+// and take every character literally, without escapes or interpolation.
+func (s *Scanner) rawString() {
+	for s.peek() != '`' && !s.isAtEnd() {
+		if s.advance() == '\n' {
+			s.newline()
+		}
+	}
+	if s.isAtEnd() {
+		lineError(s.line, "unterminated raw string")
+		return
 	}
 	s.advance()
-	// trim surrounding quotes
 	var value = string([]rune(s.source)[s.start+1 : s.current-1])
 	s.addToken(STRING, value)
 }
 
+// number scans decimal literals with an optional fraction and exponent, and
+// 0x hexadecimal and 0b binary integers. Underscores may separate digits.
+// Literals without a fraction or exponent are ints.
 func (s *Scanner) number() {
-	for unicode.IsDigit(s.peek()) {
+	var first = []rune(s.source)[s.start]
+	if first == '0' && (s.peek() == 'x' || s.peek() == 'X') {
 		s.advance()
+		s.radixNumber(16, "hexadecimal")
+		return
 	}
+	if first == '0' && (s.peek() == 'b' || s.peek() == 'B') {
+		s.advance()
+		s.radixNumber(2, "binary")
+		return
+	}
+	var ok = s.digits(isDigit)
+	var isFloat = false
 	// Look for a fractional part.
-	if s.peek() == '.' && unicode.IsDigit(s.peekNext()) {
+	if s.peek() == '.' {
+		if !isDigit(s.peekNext()) {
+			s.errorAt(s.current, "Expect digit after decimal point.")
+			s.advance()
+			return
+		}
 		// Consume the "."
 		s.advance()
-		for unicode.IsDigit(s.peek()) {
+		ok = s.digits(isDigit) && ok
+		isFloat = true
+	}
+	if s.peek() == 'e' || s.peek() == 'E' {
+		isFloat = true
+		var exponent = s.current
+		s.advance()
+		if s.peek() == '+' || s.peek() == '-' {
 			s.advance()
 		}
+		if !isDigit(s.peek()) {
+			s.errorAt(exponent, "Expect digit in exponent.")
+			s.skipWord()
+			return
+		}
+		ok = s.digits(isDigit) && ok
+	}
+	if !s.endOfNumber("number") || !ok {
+		return
+	}
+	var num_string = strings.ReplaceAll(string([]rune(s.source)[s.start:s.current]), "_", "")
+	if !isFloat {
+		var integer, err = strconv.ParseInt(num_string, 10, 64)
+		if err != nil {
+			s.errorAt(s.start, "Integer literal out of range.")
+			return
+		}
+		s.addToken(NUMBER, integer)
+		return
 	}
-	var num_string = string([]rune(s.source)[s.start:s.current])
 	var number, err = strconv.ParseFloat(num_string, 64)
 	if err != nil {
-		error(s.line, "float parse error scanning")
+		s.errorAt(s.start, "Number literal out of range.")
+		return
 	}
 
 	s.addToken(NUMBER, number)
@@ -114,8 +259,82 @@ func (s *Scanner) number() {
 	// Double.parseDouble(source.substring(start, current)));
 }
 
+func (s *Scanner) radixNumber(base int, name string) {
+	var valid = isDigit
+	if base == 16 {
+		valid = isHexDigit
+	} else if base == 2 {
+		valid = isBinaryDigit
+	}
+	if !valid(s.peek()) {
+		s.errorAt(s.current, "Expect "+name+" digit after '"+string([]rune(s.source)[s.start:s.current])+"'.")
+		s.skipWord()
+		return
+	}
+	var ok = s.digits(valid)
+	if !s.endOfNumber(name+" number") || !ok {
+		return
+	}
+	var digits = strings.ReplaceAll(string([]rune(s.source)[s.start+2:s.current]), "_", "")
+	var number, err = strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		s.errorAt(s.start, "Integer literal out of range.")
+		return
+	}
+	s.addToken(NUMBER, number)
+}
+
+// digits consumes a run of digits in which single underscores may separate
+// two digits. It reports misplaced underscores and returns false for them.
+func (s *Scanner) digits(valid func(rune) bool) bool {
+	var ok = true
+	for valid(s.peek()) || s.peek() == '_' {
+		if s.peek() == '_' && !valid(s.peekNext()) {
+			s.errorAt(s.current, "Underscore must separate digits.")
+			ok = false
+		}
+		s.advance()
+	}
+	return ok
+}
+
+// endOfNumber reports letters and digits glued to the end of a literal.
+func (s *Scanner) endOfNumber(name string) bool {
+	if !isAlpha(s.peek()) && !unicode.IsDigit(s.peek()) {
+		return true
+	}
+	s.errorAt(s.current, "Unexpected character '"+string(s.peek())+"' in "+name+".")
+	s.skipWord()
+	return false
+}
+
+// skipWord drops the rest of a malformed literal so it is reported once.
+func (s *Scanner) skipWord() {
+	for isAlpha(s.peek()) || unicode.IsDigit(s.peek()) {
+		s.advance()
+	}
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c rune) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isBinaryDigit(c rune) bool {
+	return c == '0' || c == '1'
+}
+
+func isAlpha(c rune) bool {
+	return unicode.IsLetter(c) || c == '_'
+}
+
+// identifier scans a name. Names may contain underscores, as magic methods
+// such as __str__ do.
 func (s *Scanner) identifier() {
-	for unicode.IsLetter(s.peek()) || unicode.IsDigit(s.peek()) {
+	for isAlpha(s.peek()) || unicode.IsDigit(s.peek()) {
 		s.advance()
 	}
 	var text = string([]rune(s.source)[s.start:s.current])
@@ -139,13 +358,35 @@ func (s *Scanner) scanToken() {
 			s.addToken(RIGHT_PAREN)
 			break
 		}
+	case '[':
+		{
+			s.addToken(LEFT_BRACKET)
+			break
+		}
+	case ']':
+		{
+			s.addToken(RIGHT_BRACKET)
+			break
+		}
 	case '{':
 		{
+			if len(s.interpolations) > 0 {
+				s.interpolations[len(s.interpolations)-1]++
+			}
 			s.addToken(LEFT_BRACE)
 			break
 		}
 	case '}':
 		{
+			if len(s.interpolations) > 0 {
+				var top = len(s.interpolations) - 1
+				if s.interpolations[top] == 0 {
+					s.interpolations = s.interpolations[:top]
+					s.string()
+					break
+				}
+				s.interpolations[top]--
+			}
 			s.addToken(RIGHT_BRACE)
 			break
 		}
@@ -179,6 +420,31 @@ func (s *Scanner) scanToken() {
 			s.addToken(STAR)
 			break
 		}
+	case '%':
+		{
+			s.addToken(PERCENT)
+			break
+		}
+	case '&':
+		{
+			s.addToken(AMPERSAND)
+			break
+		}
+	case '|':
+		{
+			s.addToken(PIPE)
+			break
+		}
+	case '^':
+		{
+			s.addToken(CARET)
+			break
+		}
+	case '~':
+		{
+			s.addToken(TILDE)
+			break
+		}
 	case '!':
 		{
 			if s.match('=') {
@@ -201,6 +467,8 @@ func (s *Scanner) scanToken() {
 		{
 			if s.match('=') {
 				s.addToken(LESS_EQUAL)
+			} else if s.match('<') {
+				s.addToken(LESS_LESS)
 			} else {
 				s.addToken(LESS)
 			}
@@ -210,6 +478,8 @@ func (s *Scanner) scanToken() {
 		{
 			if s.match('=') {
 				s.addToken(GREATER_EQUAL)
+			} else if s.match('>') {
+				s.addToken(GREATER_GREATER)
 			} else {
 				s.addToken(GREATER)
 			}
@@ -224,12 +494,18 @@ func (s *Scanner) scanToken() {
 				}
 			} else if s.peek() == '*' {
 				for {
+					if s.isAtEnd() {
+						lineError(s.line, "unterminated comment")
+						break
+					}
 					if s.peek() == '*' && s.peekNext() == '/' {
 						s.advance()
 						s.advance()
 						break
 					}
-					s.advance()
+					if s.advance() == '\n' {
+						s.newline()
+					}
 				}
 			} else {
 				s.addToken(SLASH)
@@ -243,7 +519,7 @@ func (s *Scanner) scanToken() {
 		break
 	case '\n':
 		{
-			s.line += 1
+			s.newline()
 			break
 		}
 	case '"':
@@ -251,14 +527,19 @@ func (s *Scanner) scanToken() {
 			s.string()
 			break
 		}
+	case '`':
+		{
+			s.rawString()
+			break
+		}
 	default:
 		{
-			if unicode.IsDigit(c) {
+			if isDigit(c) {
 				s.number()
-			} else if unicode.IsLetter(c) {
+			} else if isAlpha(c) {
 				s.identifier()
 			} else {
-				error(s.line, "unexpected character")
+				lineError(s.line, "unexpected character")
 			}
 			break
 		}
@@ -10,8 +10,12 @@ visitClassStmt(stmt *Class) any
 visitExpressionStmt(stmt *Expression) any
 visitFunctionStmt(stmt *Function) any
 visitIfStmt(stmt *If) any
+visitImportStmt(stmt *Import) any
 visitPrintStmt(stmt *Print) any
 visitReturnStmt(stmt *Return) any
+visitThrowStmt(stmt *Throw) any
+visitTraitStmt(stmt *Trait) any
+visitTryStmt(stmt *Try) any
 visitVaStmt(stmt *Va) any
 visitWhileStmt(stmt *While) any
  }
@@ -32,6 +36,7 @@ statements: statements,
 type Class struct {
 name Token
 superclass *Variable
+traits []*Variable
 methods []*Function
 }
 
@@ -39,10 +44,11 @@ func (class_ *Class) accept(visitor stmtVisitor) any {
 return visitor.visitClassStmt(class_)
 }
 
-func newClass(name Token, superclass *Variable, methods []*Function, ) *Class {
+func newClass(name Token, superclass *Variable, traits []*Variable, methods []*Function, ) *Class {
 	return &Class{
 name: name,
 superclass: superclass,
+traits: traits,
 methods: methods,
  }
  }
@@ -63,17 +69,19 @@ type Function struct {
 name Token
 params []Token
 body []Stmt
+isGetter bool
 }
 
 func (function_ *Function) accept(visitor stmtVisitor) any {
 return visitor.visitFunctionStmt(function_)
 }
 
-func newFunction(name Token, params []Token, body []Stmt, ) *Function {
+func newFunction(name Token, params []Token, body []Stmt, isGetter bool, ) *Function {
 	return &Function{
 name: name,
 params: params,
 body: body,
+isGetter: isGetter,
  }
  }
 type If struct {
@@ -93,6 +101,23 @@ thenBranch: thenBranch,
 elseBranch: elseBranch,
  }
  }
+type Import struct {
+keyword Token
+path Token
+name Token
+}
+
+func (import_ *Import) accept(visitor stmtVisitor) any {
+return visitor.visitImportStmt(import_)
+}
+
+func newImport(keyword Token, path Token, name Token, ) *Import {
+	return &Import{
+keyword: keyword,
+path: path,
+name: name,
+ }
+ }
 type Print struct {
 expression Expr
 }
@@ -109,16 +134,69 @@ expression: expression,
 type Return struct {
 keyword Token
 value Expr
+tail bool
 }
 
 func (return_ *Return) accept(visitor stmtVisitor) any {
 return visitor.visitReturnStmt(return_)
 }
 
-func newReturn(keyword Token, value Expr, ) *Return {
+func newReturn(keyword Token, value Expr, tail bool, ) *Return {
 	return &Return{
 keyword: keyword,
 value: value,
+tail: tail,
+ }
+ }
+type Throw struct {
+keyword Token
+value Expr
+}
+
+func (throw_ *Throw) accept(visitor stmtVisitor) any {
+return visitor.visitThrowStmt(throw_)
+}
+
+func newThrow(keyword Token, value Expr, ) *Throw {
+	return &Throw{
+keyword: keyword,
+value: value,
+ }
+ }
+type Trait struct {
+name Token
+methods []*Function
+}
+
+func (trait_ *Trait) accept(visitor stmtVisitor) any {
+return visitor.visitTraitStmt(trait_)
+}
+
+func newTrait(name Token, methods []*Function, ) *Trait {
+	return &Trait{
+name: name,
+methods: methods,
+ }
+ }
+type Try struct {
+keyword Token
+body []Stmt
+catchName *Token
+catchBody []Stmt
+finallyBody []Stmt
+}
+
+func (try_ *Try) accept(visitor stmtVisitor) any {
+return visitor.visitTryStmt(try_)
+}
+
+func newTry(keyword Token, body []Stmt, catchName *Token, catchBody []Stmt, finallyBody []Stmt, ) *Try {
+	return &Try{
+keyword: keyword,
+body: body,
+catchName: catchName,
+catchBody: catchBody,
+finallyBody: finallyBody,
  }
  }
 type Va struct {
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// withStdout sends the output of print and the natives to w.
+func withStdout(w io.Writer) interpreterOption {
+	return func(i *Interpreter) {
+		i.stdout = w
+	}
+}
+
+// withStderr sends the output of eprint() and error reports to w.
+func withStderr(w io.Writer) interpreterOption {
+	return func(i *Interpreter) {
+		i.stderr = w
+	}
+}
+
+// withStdin makes readLine() and input() read from r. Pass the same
+// *bufio.Reader used elsewhere to share its buffered input.
+func withStdin(r io.Reader) interpreterOption {
+	return func(i *Interpreter) {
+		reader, ok := r.(*bufio.Reader)
+		if !ok {
+			reader = bufio.NewReader(r)
+		}
+		i.stdin = reader
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// runCaptured runs a script and returns what it wrote to stdout and stderr.
+func runCaptured(source string, input string, options ...interpreterOption) (string, string) {
+	return runCapturedAt(source, "", input, options...)
+}
+
+// runCapturedAt runs a script as if it was read from path.
+func runCapturedAt(source string, path string, input string, options ...interpreterOption) (string, string) {
+	var stdout, stderr strings.Builder
+	options = append(options, withStdout(&stdout), withStderr(&stderr), withStdin(strings.NewReader(input)))
+	errorFlag = false
+	run(source, path, options...)
+	errorFlag = false
+	return stdout.String(), stderr.String()
+}
+
+func TestStreams(t *testing.T) {
+	var tests = []struct {
+		name   string
+		source string
+		input  string
+		stdout string
+		stderr string
+	}{
+		{"print", `print "hello"; print 1 + 2;`, "", "hello\n3\n", ""},
+		{"eprint", `eprint("oops"); print "done";`, "", "done\n", "oops\n"},
+		{"readLine", `print readLine(); print readLine(); print readLine();`, "one\ntwo\r\n", "one\ntwo\nnil\n", ""},
+		{"input", `var name = input("name? "); print "hi " + name;`, "lox\n", "name? hi lox\n", ""},
+		{"runtime error", `print 1; print -"a";`, "", "1\n",
+			"error report in line  1 in  somewhere  with message  Operand a must be a number.\n    [line 1] in script\n"},
+		{"compile error", `print ;`, "", "",
+			"error report in line  1 in  at ';' with message  Expect expression.\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr = runCaptured(test.source, test.input)
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+			if stderr != test.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, test.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// loxStringer is implemented by compound values, such as lists and maps,
+// whose text includes their elements. seen holds the values currently being
+// printed, so a value that contains itself prints as "..." instead of
+// recursing forever.
+type loxStringer interface {
+	stringify(i *Interpreter, seen map[any]bool) string
+}
+
+// stringify converts a value to the text print shows for it.
+func (i *Interpreter) stringify(value any) string {
+	return i.stringifySeen(value, map[any]bool{})
+}
+
+func (i *Interpreter) stringifySeen(value any, seen map[any]bool) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatNumber(v)
+	case string:
+		return v
+	case *LoxInstance:
+		text, ok := i.callMagic(i.callSite("__str__"), v, "__str__")
+		if ok {
+			str, isString := text.(string)
+			if !isString {
+				i.callSiteError("__str__ must return a string.")
+			}
+			return str
+		}
+		return v.String()
+	case loxStringer:
+		if seen[value] {
+			return "..."
+		}
+		seen[value] = true
+		var text = v.stringify(i, seen)
+		delete(seen, value)
+		return text
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// formatNumber prints a float the way jlox does, with Java's
+// Double.toString, except that integral values keep their ".0" so that 1.0
+// can be told apart from the int 1. Magnitudes from 1e-3 up to 1e7 are
+// written in full and the rest as 1.0E21 or 1.5E-7.
+func formatNumber(n float64) string {
+	switch {
+	case math.IsNaN(n):
+		return "NaN"
+	case math.IsInf(n, 1):
+		return "Infinity"
+	case math.IsInf(n, -1):
+		return "-Infinity"
+	}
+	var magnitude = math.Abs(n)
+	if magnitude == 0 || (magnitude >= 1e-3 && magnitude < 1e7) {
+		var text = strconv.FormatFloat(n, 'f', -1, 64)
+		if !strings.Contains(text, ".") {
+			text += ".0"
+		}
+		return text
+	}
+	var text = strconv.FormatFloat(n, 'e', -1, 64)
+	var mantissa, exponent, _ = strings.Cut(text, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	var power, _ = strconv.Atoi(exponent)
+	return mantissa + "E" + strconv.Itoa(power)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormatNumber(t *testing.T) {
+	var tests = []struct {
+		value float64
+		want  string
+	}{
+		{0, "0.0"},
+		{math.Copysign(0, -1), "-0.0"},
+		{1, "1.0"},
+		{-2.5, "-2.5"},
+		{0.30000000000000004, "0.30000000000000004"},
+		{0.001, "0.001"},
+		{0.0001, "1.0E-4"},
+		{1.5e-7, "1.5E-7"},
+		{1234567, "1234567.0"},
+		{1e7, "1.0E7"},
+		{12345678.9, "1.23456789E7"},
+		{1e20, "1.0E20"},
+		{1e21, "1.0E21"},
+		{-1e300, "-1.0E300"},
+		{math.NaN(), "NaN"},
+		{math.Inf(1), "Infinity"},
+		{math.Inf(-1), "-Infinity"},
+	}
+	for _, test := range tests {
+		if got := formatNumber(test.value); got != test.want {
+			t.Errorf("formatNumber(%v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// traceEvent is one line of a trace. Depth is the number of active calls.
+// Calls and returns are located at the call site, and cover natives and
+// classes as well as Lox functions. For Lox functions, defined is where the
+// function is declared and receiver the class of its "this".
+type traceEvent struct {
+	Event     string           `json:"event"`
+	File      string           `json:"file"`
+	Line      int              `json:"line"`
+	Depth     int              `json:"depth"`
+	Statement string           `json:"statement,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Defined   string           `json:"defined,omitempty"`
+	Receiver  string           `json:"receiver,omitempty"`
+	Arguments *[]any           `json:"arguments,omitempty"`
+	Value     *json.RawMessage `json:"value,omitempty"`
+}
+
+// Tracer writes every statement, call, return and variable assignment as a
+// line of JSON. Every call is matched by a return or a tailcall event.
+// Values are written as JSON when they are nil, booleans, finite numbers or
+// strings, and as their text otherwise; __str__ isn't called, so tracing
+// never runs Lox code.
+type Tracer struct {
+	encoder *json.Encoder
+	err     error
+}
+
+func newTracer(out io.Writer) *Tracer {
+	return &Tracer{encoder: json.NewEncoder(out)}
+}
+
+func (t *Tracer) emit(event traceEvent) {
+	if t.err == nil {
+		t.err = t.encoder.Encode(event)
+	}
+}
+
+func (t *Tracer) loaded(i *Interpreter, path string, statements []Stmt) {}
+
+func (t *Tracer) beforeStatement(i *Interpreter, stmt Stmt) {
+	line, ok := i.lines[stmt]
+	if !ok {
+		return
+	}
+	t.emit(traceEvent{
+		Event:     "statement",
+		File:      i.module.path,
+		Line:      line,
+		Depth:     len(i.frames),
+		Statement: fmt.Sprintf("%T", stmt)[len("*main."):],
+	})
+}
+
+func (t *Tracer) enterFunction(i *Interpreter, function LoxCallable, arguments []any) {
+	var values = []any{}
+	for _, argument := range arguments {
+		values = append(values, traceValue(argument))
+	}
+	var event = t.callEvent(i, "call", function)
+	event.Arguments = &values
+	t.emit(event)
+}
+
+// A function that ends with a tail call returns the callee's value, which
+// isn't known yet, so its frame ends with a tailcall event instead.
+func (t *Tracer) exitFunction(i *Interpreter, function LoxCallable, value any) {
+	if _, ok := value.(*tailCall); ok {
+		t.emit(t.callEvent(i, "tailcall", function))
+		return
+	}
+	var event = t.callEvent(i, "return", function)
+	event.Value = traceJSON(value)
+	t.emit(event)
+}
+
+func (t *Tracer) callEvent(i *Interpreter, kind string, function LoxCallable) traceEvent {
+	var event = traceEvent{
+		Event: kind,
+		File:  i.module.path,
+		Line:  i.callSite("").line,
+		Depth: len(i.frames),
+	}
+	switch function := function.(type) {
+	case *LoxFunction:
+		event.Name = function.declaration.name.lexeme
+		event.Defined = fmt.Sprintf("%s:%d", function.module.path, function.declaration.name.line)
+		var receiver = function.receiver
+		if receiver == nil && len(i.frames) > 0 {
+			receiver = i.frames[len(i.frames)-1].receiver
+		}
+		if receiver != nil {
+			event.Receiver = receiver.klass.name
+		}
+	case *LoxClass:
+		event.Name = function.name
+	default:
+		event.Name = nativeName(i, function)
+	}
+	return event
+}
+
+// nativeName finds the name a native is defined under, as a builtin or as
+// the export of a native module.
+func nativeName(i *Interpreter, function LoxCallable) string {
+	for name, value := range i.builtins.values {
+		if value == function {
+			return name
+		}
+	}
+	for module := range nativeModules {
+		if loaded, ok := i.modules[module]; ok {
+			for name, value := range loaded.globals.values {
+				if value == function {
+					return module + "." + name
+				}
+			}
+		}
+	}
+	return fmt.Sprint(function)
+}
+
+func (t *Tracer) branchTaken(i *Interpreter, node any, branch int) {}
+
+func (t *Tracer) assigned(i *Interpreter, name Token, value any) {
+	t.emit(traceEvent{
+		Event: "assign",
+		File:  i.module.path,
+		Line:  name.line,
+		Depth: len(i.frames),
+		Name:  name.lexeme,
+		Value: traceJSON(value),
+	})
+}
+
+func traceValue(value any) any {
+	switch v := value.(type) {
+	case nil, bool, int64, string:
+		return v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return formatNumber(v)
+		}
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func traceJSON(value any) *json.RawMessage {
+	var data, _ = json.Marshal(traceValue(value))
+	var message = json.RawMessage(data)
+	return &message
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestTraceBalanced checks that every call event is closed by a return or a
+// tailcall event, including for frames replaced by tail calls.
+func TestTraceBalanced(t *testing.T) {
+	var source = `
+fun id(x) { return x; }
+fun f(x) { return id(x); }
+fun count(n) { if (n == 0) return "done"; return count(n - 1); }
+class A { get() { return id(this); } }
+print f(1);
+print count(3);
+print A().get();
+`
+	var out bytes.Buffer
+	interpretSource(t, source, withHook(newTracer(&out)))
+	var decoder = json.NewDecoder(&out)
+	var open = []string{}
+	var events = []string{}
+	for decoder.More() {
+		var event traceEvent
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		switch event.Event {
+		case "call":
+			open = append(open, event.Name)
+		case "return", "tailcall":
+			if len(open) == 0 || open[len(open)-1] != event.Name {
+				t.Fatalf("%s of %s doesn't match the open calls %v", event.Event, event.Name, open)
+			}
+			open = open[:len(open)-1]
+		default:
+			continue
+		}
+		events = append(events, event.Event+" "+event.Name)
+	}
+	if len(open) != 0 {
+		t.Errorf("calls %v never returned", open)
+	}
+	var want = []string{
+		"call f", "tailcall f", "call id", "return id",
+		"call count", "tailcall count", "call count", "tailcall count",
+		"call count", "tailcall count", "call count", "return count",
+		"call A", "return A", "call get", "tailcall get", "call id", "return id",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+	for index := range want {
+		if events[index] != want[index] {
+			t.Fatalf("got events %v, want %v", events, want)
+		}
+	}
+}
+
+func TestTraceNativesAndClasses(t *testing.T) {
+	var source = `
+import "math" as math;
+class P {}
+class Q { init(x) { this.x = x; } }
+P();
+Q(1);
+str(2);
+math.round(1.25, 1, math.HALF_EVEN);
+`
+	var out bytes.Buffer
+	interpretSource(t, source, withHook(newTracer(&out)))
+	var decoder = json.NewDecoder(&out)
+	var events = []string{}
+	for decoder.More() {
+		var event traceEvent
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Event != "call" && event.Event != "return" {
+			continue
+		}
+		var detail = ""
+		if event.Arguments != nil {
+			var arguments, _ = json.Marshal(event.Arguments)
+			detail = string(arguments)
+		}
+		if event.Value != nil {
+			detail = string(*event.Value)
+		}
+		events = append(events, fmt.Sprintf("%s %s %d %s", event.Event, event.Name, event.Line, detail))
+	}
+	var want = []string{
+		`call P 5 []`,
+		`return P 5 "P instance"`,
+		`call Q 6 [1]`,
+		`call init 6 [1]`,
+		`return init 6 "Q instance"`,
+		`return Q 6 "Q instance"`,
+		`call str 7 [2]`,
+		`return str 7 "2"`,
+		`call math.round 8 [1.25,1,"half_even"]`,
+		`return math.round 8 1.2`,
+	}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("got events\n%s\nwant\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+}